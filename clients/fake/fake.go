@@ -0,0 +1,292 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	midtransClient "payment-service/clients/midtrans"
+	"payment-service/common/money"
+	"payment-service/common/util"
+	"payment-service/constants"
+	error2 "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	fakeServerKey   = "fake-server-key"
+	fakeRedirectURL = "https://sandbox.payment-service.local/pay/%s"
+	fakeDeeplinkURL = "https://sandbox.payment-service.local/%s/%s"
+	fakeBillerCode  = "70012"
+)
+
+// FakeClient is an offline payment gateway for local development. It speaks
+// the Midtrans notification format, signed with a fixed server key, and keeps
+// the transactions it has seen in memory.
+type FakeClient struct {
+	notifications *midtransClient.MidtransClient
+	mu            sync.Mutex
+	transactions  map[string]dto.SimulateNotificationRequest
+	refunded      map[string]int64
+	refundKeys    map[string]bool
+}
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		notifications: midtransClient.NewMidtransClient(fakeServerKey, false),
+		transactions:  make(map[string]dto.SimulateNotificationRequest),
+		refunded:      make(map[string]int64),
+		refundKeys:    make(map[string]bool),
+	}
+}
+
+func (f *FakeClient) Provider() constants.PaymentProvider {
+	return constants.FakeProvider
+}
+
+// CreatePaymentLink returns a token and redirect URL derived from the order
+// ID, so that the same order always gets the same link.
+func (f *FakeClient) CreatePaymentLink(request *dto.PaymentRequest) (*dto.PaymentLinkResponse, error) {
+	if !request.ExpiredAt.After(time.Now()) {
+		return nil, error2.ErrExpiredAtInvalid
+	}
+
+	token := fmt.Sprintf("fake-%s", request.OrderID)
+	return &dto.PaymentLinkResponse{
+		Token:       token,
+		RedirectURL: fmt.Sprintf(fakeRedirectURL, token),
+	}, nil
+}
+
+// GetStatus returns the last simulated status of the order. Like Midtrans,
+// an order the customer never paid for is not found.
+func (f *FakeClient) GetStatus(orderID string) (*dto.PaymentNotification, error) {
+	transaction, ok := f.transaction(orderID)
+	if !ok {
+		return nil, error2.ErrGatewayTransactionNotFound
+	}
+
+	payload, err := f.sign(&transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.ParseNotification(payload)
+}
+
+// Charge returns a virtual account, QR string or deeplink derived from the
+// order ID and records the transaction as pending.
+func (f *FakeClient) Charge(request *dto.ChargeRequest) (*dto.ChargeResponse, error) {
+	if !request.ExpiredAt.After(time.Now()) {
+		return nil, error2.ErrExpiredAtInvalid
+	}
+
+	orderID, err := uuid.Parse(request.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction := dto.SimulateNotificationRequest{
+		OrderID:           orderID,
+		Amount:            request.Amount,
+		TransactionStatus: constants.PendingString,
+	}
+	result := &dto.ChargeResponse{
+		TransactionID: f.transactionID(orderID.String()),
+	}
+
+	vaNumber := f.vaNumber(orderID.String())
+	switch request.PaymentMethod {
+	case constants.BCAVirtualAccount, constants.BNIVirtualAccount, constants.BRIVirtualAccount, constants.PermataVirtualAccount:
+		bank := strings.TrimSuffix(request.PaymentMethod.String(), "_va")
+		transaction.PaymentType = "bank_transfer"
+		transaction.Bank = bank
+		result.VANumber = &vaNumber
+		result.Bank = &bank
+	case constants.EChannel:
+		bank := "mandiri"
+		billerCode := fakeBillerCode
+		transaction.PaymentType = constants.EChannel.String()
+		result.VANumber = &vaNumber
+		result.Bank = &bank
+		result.BillerCode = &billerCode
+	case constants.QRIS:
+		qrString := fmt.Sprintf("fake-qr-%s", orderID)
+		transaction.PaymentType = constants.QRIS.String()
+		result.QRString = &qrString
+	case constants.GoPay, constants.ShopeePay:
+		deeplink := fmt.Sprintf(fakeDeeplinkURL, request.PaymentMethod, orderID)
+		transaction.PaymentType = request.PaymentMethod.String()
+		result.Deeplink = &deeplink
+	default:
+		return nil, error2.ErrInvalidChargeMethod
+	}
+
+	result.PaymentMethod = transaction.PaymentType
+	f.store(&transaction)
+	return result, nil
+}
+
+func (f *FakeClient) Cancel(orderID string, status constants.PaymentStatus) error {
+	transaction, ok := f.transaction(orderID)
+	if !ok {
+		return error2.ErrGatewayTransactionNotFound
+	}
+
+	switch transaction.TransactionStatus {
+	case constants.SettlementString, constants.RefundString, constants.PartialRefundString:
+		return fmt.Errorf("%w: transaction is already %s", error2.ErrGatewayRejected, transaction.TransactionStatus)
+	}
+
+	transaction.TransactionStatus = constants.ExpireString
+	if status == constants.Authorize || status == constants.Capture {
+		transaction.TransactionStatus = constants.CancelString
+	}
+	f.store(&transaction)
+
+	return nil
+}
+
+func (f *FakeClient) Refund(orderID string, request *dto.GatewayRefundRequest) error {
+	transaction, ok := f.transaction(orderID)
+	if !ok {
+		return error2.ErrGatewayTransactionNotFound
+	}
+
+	// Like Midtrans, a refund key is only refunded once.
+	f.mu.Lock()
+	if !f.refundKeys[request.RefundKey] {
+		f.refundKeys[request.RefundKey] = true
+		f.refunded[orderID] += request.Amount
+	}
+	refunded := f.refunded[orderID]
+	f.mu.Unlock()
+
+	transaction.TransactionStatus = constants.RefundString
+	if refunded < transaction.Amount {
+		transaction.TransactionStatus = constants.PartialRefundString
+	}
+	f.store(&transaction)
+
+	return nil
+}
+
+func (f *FakeClient) ParseNotification(payload []byte) (*dto.PaymentNotification, error) {
+	notification, err := f.notifications.ParseNotification(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	notification.Provider = f.Provider()
+	return notification, nil
+}
+
+// SimulateNotification records the new status of the transaction and returns
+// the signed notification the gateway would send for it. Without a payment
+// type, the one of a direct charge is kept, or a BCA virtual account used.
+func (f *FakeClient) SimulateNotification(request *dto.SimulateNotificationRequest) ([]byte, error) {
+	if !request.TransactionStatus.IsValid() {
+		return nil, error2.ErrInvalidStatus
+	}
+
+	transaction := *request
+	if transaction.PaymentType == "" {
+		charged, ok := f.transaction(transaction.OrderID.String())
+		if ok {
+			transaction.PaymentType = charged.PaymentType
+			transaction.Bank = charged.Bank
+		}
+	}
+	if transaction.PaymentType == "" {
+		transaction.PaymentType = "bank_transfer"
+	}
+	f.store(&transaction)
+
+	return f.sign(&transaction)
+}
+
+func (f *FakeClient) transaction(orderID string) (dto.SimulateNotificationRequest, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	transaction, ok := f.transactions[orderID]
+	return transaction, ok
+}
+
+func (f *FakeClient) store(transaction *dto.SimulateNotificationRequest) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.transactions[transaction.OrderID.String()] = *transaction
+}
+
+func (f *FakeClient) transactionID(orderID string) string {
+	return fmt.Sprintf("fake-%s", orderID)
+}
+
+func (f *FakeClient) vaNumber(orderID string) string {
+	return fmt.Sprintf("%011d", crc32.ChecksumIEEE([]byte(orderID)))
+}
+
+// statusCode returns the status_code Midtrans sends with the transaction
+// status.
+func (f *FakeClient) statusCode(status constants.PaymentStatusString) string {
+	switch status {
+	case constants.PendingString, constants.AuthorizeString:
+		return "201"
+	case constants.DenyString, constants.FailureString:
+		return "202"
+	case constants.ExpireString:
+		return "407"
+	default:
+		return "200"
+	}
+}
+
+func (f *FakeClient) sign(transaction *dto.SimulateNotificationRequest) ([]byte, error) {
+	orderID := transaction.OrderID.String()
+	notification := midtransClient.Notification{
+		TransactionTime:   time.Now().Format(time.DateTime),
+		TransactionStatus: transaction.TransactionStatus,
+		TransactionID:     f.transactionID(orderID),
+		StatusMessage:     "fake notification",
+		StatusCode:        f.statusCode(transaction.TransactionStatus),
+		PaymentType:       transaction.PaymentType,
+		OrderID:           transaction.OrderID,
+		MerchantID:        "FAKE",
+		GrossAmount:       fmt.Sprintf("%s.00", money.New(transaction.Amount, constants.IDR).Decimal()),
+		FraudStatus:       constants.FraudAccept,
+		Currency:          constants.IDR,
+	}
+
+	switch transaction.PaymentType {
+	case "bank_transfer":
+		bank := transaction.Bank
+		if bank == "" {
+			bank = "bca"
+		}
+		if bank == "permata" {
+			notification.PermataVANumber = f.vaNumber(orderID)
+		} else {
+			notification.VANumbers = []midtransClient.VANumber{{
+				Bank:     bank,
+				VaNumber: f.vaNumber(orderID),
+			}}
+		}
+	case constants.EChannel.String():
+		notification.BillKey = f.vaNumber(orderID)
+		notification.BillerCode = fakeBillerCode
+	case constants.QRIS.String():
+		acquirer := "gopay"
+		notification.Acquirer = &acquirer
+	}
+
+	payload := fmt.Sprintf("%s%s%s%s", orderID, notification.StatusCode, notification.GrossAmount, fakeServerKey)
+	notification.SignatureKey = util.GenerateSHA512(payload)
+
+	return json.Marshal(notification)
+}
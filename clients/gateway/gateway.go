@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+)
+
+// IPaymentGateway is implemented by every payment provider. Payments remember
+// the provider they were created with, so that later calls and notifications
+// go to the same gateway.
+type IPaymentGateway interface {
+	Provider() constants.PaymentProvider
+	CreatePaymentLink(*dto.PaymentRequest) (*dto.PaymentLinkResponse, error)
+	Charge(*dto.ChargeRequest) (*dto.ChargeResponse, error)
+	GetStatus(orderID string) (*dto.PaymentNotification, error)
+	Cancel(orderID string, status constants.PaymentStatus) error
+	Refund(orderID string, request *dto.GatewayRefundRequest) error
+	ParseNotification(payload []byte) (*dto.PaymentNotification, error)
+}
+
+// ISimulator is implemented by gateways that can emit their own signed
+// notifications, so that payments can be settled without a real gateway.
+type ISimulator interface {
+	SimulateNotification(*dto.SimulateNotificationRequest) ([]byte, error)
+}
+
+type GatewayRegistry struct {
+	defaultProvider constants.PaymentProvider
+	gateways        map[constants.PaymentProvider]IPaymentGateway
+}
+
+type IGatewayRegistry interface {
+	Get(constants.PaymentProvider) (IPaymentGateway, error)
+}
+
+func NewGatewayRegistry(defaultProvider constants.PaymentProvider, gateways ...IPaymentGateway) IGatewayRegistry {
+	if defaultProvider == "" {
+		defaultProvider = constants.DefaultPaymentProvider
+	}
+
+	registry := &GatewayRegistry{
+		defaultProvider: defaultProvider,
+		gateways:        make(map[constants.PaymentProvider]IPaymentGateway, len(gateways)),
+	}
+	for _, gateway := range gateways {
+		registry.gateways[gateway.Provider()] = gateway
+	}
+
+	return registry
+}
+
+// Get returns the gateway of the provider, or of the default provider when
+// none is given.
+func (g *GatewayRegistry) Get(provider constants.PaymentProvider) (IPaymentGateway, error) {
+	if provider == "" {
+		provider = g.defaultProvider
+	}
+
+	gateway, ok := g.gateways[provider]
+	if !ok {
+		return nil, errPayment.ErrUnsupportedProvider
+	}
+
+	return gateway, nil
+}
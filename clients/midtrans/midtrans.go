@@ -1,12 +1,22 @@
 package client
 
 import (
-	"github.com/midtrans/midtrans-go"
-	"github.com/midtrans/midtrans-go/snap"
-	"github.com/sirupsen/logrus"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"payment-service/common/money"
+	"payment-service/common/util"
+	"payment-service/constants"
 	error2 "payment-service/constants/error/payment"
 	"payment-service/domain/dto"
+	"strings"
 	"time"
+
+	"github.com/midtrans/midtrans-go"
+	"github.com/midtrans/midtrans-go/coreapi"
+	"github.com/midtrans/midtrans-go/snap"
+	"github.com/sirupsen/logrus"
 )
 
 type MidtransClient struct {
@@ -14,10 +24,6 @@ type MidtransClient struct {
 	IsProduction bool
 }
 
-type IMidtransClient interface {
-	CreatePaymentLink(request *dto.PaymentRequest) (*MidtransData, error)
-}
-
 func NewMidtransClient(serverKey string, isProduction bool) *MidtransClient {
 	return &MidtransClient{
 		ServerKey:    serverKey,
@@ -25,7 +31,353 @@ func NewMidtransClient(serverKey string, isProduction bool) *MidtransClient {
 	}
 }
 
-func (m *MidtransClient) CreatePaymentLink(request *dto.PaymentRequest) (*MidtransData, error) {
+func (m *MidtransClient) Provider() constants.PaymentProvider {
+	return constants.MidtransProvider
+}
+
+func (m *MidtransClient) environment() midtrans.EnvironmentType {
+	if m.IsProduction {
+		return midtrans.Production
+	}
+	return midtrans.Sandbox
+}
+
+func (m *MidtransClient) coreAPIClient() coreapi.Client {
+	var coreClient coreapi.Client
+	coreClient.New(m.ServerKey, m.environment())
+	return coreClient
+}
+
+// gatewayError converts a Midtrans API error, returning
+// ErrGatewayTransactionNotFound when Midtrans has no transaction for the
+// order, e.g. a Snap link the customer never opened, and wrapping
+// ErrGatewayRejected when Midtrans refused the request itself, e.g. expiring
+// a transaction that is already settled. Retrying a rejected request cannot
+// succeed.
+func gatewayError(err *midtrans.Error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case err.StatusCode == http.StatusNotFound:
+		return error2.ErrGatewayTransactionNotFound
+	case err.StatusCode == http.StatusRequestTimeout || err.StatusCode == http.StatusTooManyRequests:
+		return err
+	case err.StatusCode >= http.StatusBadRequest && err.StatusCode < http.StatusInternalServerError:
+		return fmt.Errorf("%w: %s", error2.ErrGatewayRejected, err.GetMessage())
+	}
+	return err
+}
+
+// Cancel stops a transaction that has not been paid. Midtrans only allows
+// cancelling card transactions; pending ones are expired instead.
+func (m *MidtransClient) Cancel(orderID string, status constants.PaymentStatus) error {
+	var err *midtrans.Error
+	switch status {
+	case constants.Authorize, constants.Capture:
+		_, err = m.coreAPIClient().CancelTransaction(orderID)
+		if err != nil {
+			logrus.Errorf("coreClient.CancelTransaction err: %v", err)
+		}
+	default:
+		_, err = m.coreAPIClient().ExpireTransaction(orderID)
+		if err != nil {
+			logrus.Errorf("coreClient.ExpireTransaction err: %v", err)
+		}
+	}
+
+	return gatewayError(err)
+}
+
+func (m *MidtransClient) Refund(orderID string, request *dto.GatewayRefundRequest) error {
+	_, err := m.coreAPIClient().RefundTransaction(orderID, &coreapi.RefundReq{
+		RefundKey: request.RefundKey,
+		Amount:    request.Amount,
+		Reason:    request.Reason,
+	})
+	if err != nil {
+		logrus.Errorf("coreClient.RefundTransaction err: %v", err)
+	}
+	return gatewayError(err)
+}
+
+// GetStatus fetches the current status of the transaction of the order from
+// Midtrans.
+func (m *MidtransClient) GetStatus(orderID string) (*dto.PaymentNotification, error) {
+	response, err := m.coreAPIClient().CheckTransaction(orderID)
+	if err != nil {
+		logrus.Errorf("coreClient.CheckTransaction err: %v", err)
+		return nil, gatewayError(err)
+	}
+
+	payload, jsonErr := json.Marshal(response)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	var notification Notification
+	jsonErr = json.Unmarshal(payload, &notification)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return m.toPaymentNotification(&notification, payload)
+}
+
+// ParseNotification verifies the signature of a Midtrans HTTP notification
+// and translates it into a PaymentNotification.
+func (m *MidtransClient) ParseNotification(payload []byte) (*dto.PaymentNotification, error) {
+	var notification Notification
+	err := json.Unmarshal(payload, &notification)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.verifySignature(&notification)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.toPaymentNotification(&notification, payload)
+}
+
+// verifySignature recomputes the Midtrans notification signature,
+// SHA512(order_id + status_code + gross_amount + server_key), and compares it
+// with the signature_key sent by the gateway.
+func (m *MidtransClient) verifySignature(notification *Notification) error {
+	payload := fmt.Sprintf("%s%s%s%s", notification.OrderID.String(), notification.StatusCode, notification.GrossAmount, m.ServerKey)
+	signature := util.GenerateSHA512(payload)
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(strings.ToLower(notification.SignatureKey))) != 1 {
+		return error2.ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// resolveStatus folds the fraud status into the transaction status: a card
+// capture rejected by fraud detection is recorded as denied, and one it
+// challenged as authorized, since the merchant may still accept or deny it.
+// Accepting it sends the capture again, which then moves the payment on.
+func (m *MidtransClient) resolveStatus(notification *Notification) constants.PaymentStatusString {
+	if notification.TransactionStatus != constants.CaptureString {
+		return notification.TransactionStatus
+	}
+
+	switch notification.FraudStatus {
+	case constants.FraudDeny:
+		return constants.DenyString
+	case constants.FraudChallenge:
+		return constants.AuthorizeString
+	default:
+		return notification.TransactionStatus
+	}
+}
+
+// isPaid reports whether the notification means the customer has paid:
+// a settlement, or a card capture accepted by fraud detection.
+func (m *MidtransClient) isPaid(notification *Notification) bool {
+	switch notification.TransactionStatus {
+	case constants.SettlementString:
+		return true
+	case constants.CaptureString:
+		return notification.FraudStatus == constants.FraudAccept
+	default:
+		return false
+	}
+}
+
+// currency returns the currency of the notification. Midtrans only settles
+// rupiah and omits it from some responses.
+func (m *MidtransClient) currency(notification *Notification) string {
+	if notification.Currency == "" {
+		return constants.IDR
+	}
+	return notification.Currency
+}
+
+func (m *MidtransClient) toPaymentNotification(notification *Notification, payload []byte) (*dto.PaymentNotification, error) {
+	transactionStatus := m.resolveStatus(notification)
+	if !transactionStatus.IsValid() {
+		return nil, error2.ErrInvalidStatus
+	}
+
+	result := &dto.PaymentNotification{
+		Provider:          m.Provider(),
+		OrderID:           notification.OrderID,
+		TransactionID:     notification.TransactionID,
+		TransactionStatus: transactionStatus,
+		FraudStatus:       notification.FraudStatus,
+		Paid:              m.isPaid(notification),
+		PaymentMethod:     notification.PaymentType,
+		Acquirer:          notification.Acquirer,
+		GrossAmount:       notification.GrossAmount,
+		Currency:          m.currency(notification),
+		RawPayload:        payload,
+	}
+	if result.Acquirer != nil && *result.Acquirer == "" {
+		result.Acquirer = nil
+	}
+	switch {
+	case len(notification.VANumbers) > 0:
+		result.VANumber = notification.VANumbers[0].VaNumber
+		result.Bank = notification.VANumbers[0].Bank
+	case notification.PermataVANumber != "":
+		result.VANumber = notification.PermataVANumber
+		result.Bank = string(midtrans.BankPermata)
+	case notification.BillKey != "":
+		result.VANumber = notification.BillKey
+		result.Bank = string(midtrans.BankMandiri)
+	}
+
+	// Refund notifications list every refund of the transaction, the latest
+	// last.
+	if len(notification.Refunds) > 0 {
+		refund := notification.Refunds[len(notification.Refunds)-1]
+		amount, err := money.Parse(refund.RefundAmount, m.currency(notification))
+		if err != nil {
+			return nil, err
+		}
+		result.Refund = &dto.GatewayRefund{
+			RefundKey: refund.RefundKey,
+			Amount:    amount.Amount,
+			Reason:    refund.Reason,
+		}
+	}
+
+	return result, nil
+}
+
+// chargeRequest translates the payment method into the Core API payment type
+// and its details.
+func (m *MidtransClient) chargeRequest(request *dto.ChargeRequest) (*coreapi.ChargeReq, error) {
+	req := &coreapi.ChargeReq{
+		TransactionDetails: midtrans.TransactionDetails{
+			OrderID:  request.OrderID,
+			GrossAmt: request.Amount,
+		},
+		Items: itemDetails(request.ItemDetail),
+		CustomerDetails: &midtrans.CustomerDetails{
+			FName:    request.CustomerDetail.Name,
+			LName:    request.CustomerDetail.LastName,
+			Email:    request.CustomerDetail.Email,
+			Phone:    request.CustomerDetail.Phone,
+			BillAddr: customerAddress(request.CustomerDetail.BillingAddress),
+			ShipAddr: customerAddress(request.CustomerDetail.ShippingAddress),
+		},
+		CustomExpiry: &coreapi.CustomExpiry{
+			ExpiryDuration: int(time.Until(request.ExpiredAt).Minutes()),
+			Unit:           "minute",
+		},
+	}
+
+	switch request.PaymentMethod {
+	case constants.BCAVirtualAccount, constants.BNIVirtualAccount, constants.BRIVirtualAccount, constants.PermataVirtualAccount:
+		req.PaymentType = coreapi.PaymentTypeBankTransfer
+		req.BankTransfer = &coreapi.BankTransferDetails{
+			Bank: midtrans.Bank(strings.TrimSuffix(request.PaymentMethod.String(), "_va")),
+		}
+	case constants.EChannel:
+		req.PaymentType = coreapi.PaymentTypeEChannel
+		req.EChannel = &coreapi.EChannelDetail{
+			BillInfo1: "Payment:",
+			BillInfo2: "Order",
+		}
+	case constants.QRIS:
+		req.PaymentType = coreapi.PaymentTypeQris
+		req.Qris = &coreapi.QrisDetails{}
+	case constants.GoPay:
+		req.PaymentType = coreapi.PaymentTypeGopay
+		req.Gopay = &coreapi.GopayDetails{}
+	case constants.ShopeePay:
+		req.PaymentType = coreapi.PaymentTypeShopeepay
+		req.ShopeePay = &coreapi.ShopeePayDetails{}
+	default:
+		return nil, error2.ErrInvalidChargeMethod
+	}
+
+	return req, nil
+}
+
+// Charge creates a Core API transaction, which returns the virtual account,
+// QR string or deeplink directly instead of a Snap payment page.
+func (m *MidtransClient) Charge(request *dto.ChargeRequest) (*dto.ChargeResponse, error) {
+	if !request.ExpiredAt.After(time.Now()) {
+		logrus.Errorf("expiryDateTime is invalid")
+		return nil, error2.ErrExpiredAtInvalid
+	}
+
+	req, err := m.chargeRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, chargeErr := m.coreAPIClient().ChargeTransaction(req)
+	if chargeErr != nil {
+		logrus.Errorf("coreClient.ChargeTransaction err: %v", chargeErr)
+		return nil, gatewayError(chargeErr)
+	}
+
+	result := &dto.ChargeResponse{
+		TransactionID: response.TransactionID,
+		PaymentMethod: response.PaymentType,
+	}
+	switch {
+	case len(response.VaNumbers) > 0:
+		result.VANumber = &response.VaNumbers[0].VANumber
+		result.Bank = &response.VaNumbers[0].Bank
+	case response.PermataVaNumber != "":
+		bank := string(midtrans.BankPermata)
+		result.VANumber = &response.PermataVaNumber
+		result.Bank = &bank
+	case response.BillKey != "":
+		bank := string(midtrans.BankMandiri)
+		result.VANumber = &response.BillKey
+		result.Bank = &bank
+		result.BillerCode = &response.BillerCode
+	}
+	if response.QRString != "" {
+		result.QRString = &response.QRString
+	}
+	for _, action := range response.Actions {
+		if action.Name == "deeplink-redirect" {
+			result.Deeplink = &action.URL
+		}
+	}
+
+	return result, nil
+}
+
+func itemDetails(items []dto.ItemDetail) *[]midtrans.ItemDetails {
+	details := make([]midtrans.ItemDetails, 0, len(items))
+	for _, item := range items {
+		details = append(details, midtrans.ItemDetails{
+			ID:    item.ID,
+			Price: item.Amount,
+			Qty:   int32(item.Quantity),
+			Name:  item.Name,
+		})
+	}
+	return &details
+}
+
+func customerAddress(address *dto.Address) *midtrans.CustomerAddress {
+	if address == nil {
+		return nil
+	}
+
+	return &midtrans.CustomerAddress{
+		FName:       address.FirstName,
+		LName:       address.LastName,
+		Phone:       address.Phone,
+		Address:     address.Address,
+		City:        address.City,
+		Postcode:    address.PostalCode,
+		CountryCode: address.CountryCode,
+	}
+}
+
+func (m *MidtransClient) CreatePaymentLink(request *dto.PaymentRequest) (*dto.PaymentLinkResponse, error) {
 	var (
 		snapClient   snap.Client
 		ISProduction = midtrans.Sandbox
@@ -57,21 +409,17 @@ func (m *MidtransClient) CreatePaymentLink(request *dto.PaymentRequest) (*Midtra
 	req := &snap.Request{
 		TransactionDetails: midtrans.TransactionDetails{
 			OrderID:  request.OrderID,
-			GrossAmt: int64(request.Amount),
+			GrossAmt: request.Amount,
 		},
 		CustomerDetail: &midtrans.CustomerDetails{
-			FName: request.CustomerDetail.Name,
-			Email: request.CustomerDetail.Email,
-			Phone: request.CustomerDetail.Phone,
-		},
-		Items: &[]midtrans.ItemDetails{
-			{
-				ID:    request.ItemDetail[0].ID,
-				Price: int64(request.ItemDetail[0].Amount),
-				Qty:   int32(request.ItemDetail[0].Quantity),
-				Name:  request.ItemDetail[0].Name,
-			},
+			FName:    request.CustomerDetail.Name,
+			LName:    request.CustomerDetail.LastName,
+			Email:    request.CustomerDetail.Email,
+			Phone:    request.CustomerDetail.Phone,
+			BillAddr: customerAddress(request.CustomerDetail.BillingAddress),
+			ShipAddr: customerAddress(request.CustomerDetail.ShippingAddress),
 		},
+		Items: itemDetails(request.ItemDetail),
 		Expiry: &snap.ExpiryDetails{
 			Unit:     expiryUnit,
 			Duration: expiryDuration,
@@ -84,7 +432,7 @@ func (m *MidtransClient) CreatePaymentLink(request *dto.PaymentRequest) (*Midtra
 		return nil, err
 	}
 
-	return &MidtransData{
+	return &dto.PaymentLinkResponse{
 		RedirectURL: response.RedirectURL,
 		Token:       response.Token,
 	}, nil
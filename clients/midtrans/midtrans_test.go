@@ -0,0 +1,91 @@
+package client
+
+import (
+	"errors"
+	"payment-service/common/util"
+	"payment-service/constants"
+	error2 "payment-service/constants/error/payment"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVerifySignature(t *testing.T) {
+	const serverKey = "server-key"
+	orderID := uuid.MustParse("0b7d2a55-2f6e-4bd3-9d4b-6a3f3f1c2a10")
+	signature := util.GenerateSHA512(orderID.String() + "200" + "150000.00" + serverKey)
+
+	tests := []struct {
+		name         string
+		serverKey    string
+		statusCode   string
+		grossAmount  string
+		signatureKey string
+		wantErr      bool
+	}{
+		{name: "valid", serverKey: serverKey, statusCode: "200", grossAmount: "150000.00", signatureKey: signature},
+		{name: "upper case signature", serverKey: serverKey, statusCode: "200", grossAmount: "150000.00", signatureKey: strings.ToUpper(signature)},
+		{name: "tampered amount", serverKey: serverKey, statusCode: "200", grossAmount: "1.00", signatureKey: signature, wantErr: true},
+		{name: "tampered status code", serverKey: serverKey, statusCode: "201", grossAmount: "150000.00", signatureKey: signature, wantErr: true},
+		{name: "other server key", serverKey: "other-key", statusCode: "200", grossAmount: "150000.00", signatureKey: signature, wantErr: true},
+		{name: "missing signature", serverKey: serverKey, statusCode: "200", grossAmount: "150000.00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewMidtransClient(tt.serverKey, false)
+			err := client.verifySignature(&Notification{
+				OrderID:      orderID,
+				StatusCode:   tt.statusCode,
+				GrossAmount:  tt.grossAmount,
+				SignatureKey: tt.signatureKey,
+			})
+			if tt.wantErr && !errors.Is(err, error2.ErrInvalidSignature) {
+				t.Fatalf("verifySignature() error = %v, want %v", err, error2.ErrInvalidSignature)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("verifySignature() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseNotificationRejectsInvalidSignature(t *testing.T) {
+	client := NewMidtransClient("server-key", false)
+	payload := `{"order_id": "0b7d2a55-2f6e-4bd3-9d4b-6a3f3f1c2a10", "status_code": "200", "gross_amount": "150000.00", "transaction_status": "settlement", "signature_key": "forged"}`
+
+	_, err := client.ParseNotification([]byte(payload))
+	if !errors.Is(err, error2.ErrInvalidSignature) {
+		t.Fatalf("ParseNotification() error = %v, want %v", err, error2.ErrInvalidSignature)
+	}
+}
+
+func TestResolveStatus(t *testing.T) {
+	tests := []struct {
+		status constants.PaymentStatusString
+		fraud  constants.FraudStatus
+		want   constants.PaymentStatusString
+		paid   bool
+	}{
+		{status: constants.CaptureString, fraud: constants.FraudAccept, want: constants.CaptureString, paid: true},
+		{status: constants.CaptureString, fraud: constants.FraudChallenge, want: constants.AuthorizeString},
+		{status: constants.CaptureString, fraud: constants.FraudDeny, want: constants.DenyString},
+		{status: constants.SettlementString, fraud: constants.FraudAccept, want: constants.SettlementString, paid: true},
+		{status: constants.SettlementString, want: constants.SettlementString, paid: true},
+		{status: constants.PendingString, want: constants.PendingString},
+	}
+
+	client := NewMidtransClient("server-key", false)
+	for _, tt := range tests {
+		t.Run(tt.status.String()+" "+tt.fraud.String(), func(t *testing.T) {
+			notification := &Notification{TransactionStatus: tt.status, FraudStatus: tt.fraud}
+			if got := client.resolveStatus(notification); got != tt.want {
+				t.Errorf("resolveStatus() = %s, want %s", got, tt.want)
+			}
+			if got := client.isPaid(notification); got != tt.paid {
+				t.Errorf("isPaid() = %v, want %v", got, tt.paid)
+			}
+		})
+	}
+}
@@ -1,5 +1,11 @@
 package client
 
+import (
+	"payment-service/constants"
+
+	"github.com/google/uuid"
+)
+
 type MidtransResponse struct {
 	Code   string       `json:"code"`
 	Status string       `json:"status"`
@@ -10,3 +16,46 @@ type MidtransData struct {
 	Token       string `json:"token"`
 	RedirectURL string `json:"redirect_url"`
 }
+
+// Notification is the HTTP notification Midtrans sends when the status of a
+// transaction changes.
+type Notification struct {
+	VANumbers         []VANumber                    `json:"va_numbers"`
+	PermataVANumber   string                        `json:"permata_va_number"`
+	BillKey           string                        `json:"bill_key"`
+	BillerCode        string                        `json:"biller_code"`
+	TransactionTime   string                        `json:"transaction_time"`
+	TransactionStatus constants.PaymentStatusString `json:"transaction_status"`
+	TransactionID     string                        `json:"transaction_id"`
+	StatusMessage     string                        `json:"status_message"`
+	StatusCode        string                        `json:"status_code"`
+	SignatureKey      string                        `json:"signature_key"`
+	SettlementTime    string                        `json:"settlement_time"`
+	PaymentType       string                        `json:"payment_type"`
+	PaymentAmount     []PaymentAmount               `json:"payment_amount"`
+	OrderID           uuid.UUID                     `json:"order_id"`
+	MerchantID        string                        `json:"merchant_id"`
+	GrossAmount       string                        `json:"gross_amount"`
+	FraudStatus       constants.FraudStatus         `json:"fraud_status"`
+	Currency          string                        `json:"currency"`
+	Acquirer          *string                       `json:"acquirer"`
+	Refunds           []Refund                      `json:"refunds"`
+}
+
+type VANumber struct {
+	VaNumber string `json:"va_number"`
+	Bank     string `json:"bank"`
+}
+
+type Refund struct {
+	RefundChargebackID int    `json:"refund_chargeback_id"`
+	RefundAmount       string `json:"refund_amount"`
+	CreatedAt          string `json:"created_at"`
+	Reason             string `json:"reason"`
+	RefundKey          string `json:"refund_key"`
+}
+
+type PaymentAmount struct {
+	PaidAt *string `json:"paid_at"`
+	Amount *string `json:"amount"`
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"os/signal"
+	"payment-service/config"
+	kafkaClient "payment-service/controllers/kafka"
+	"payment-service/controllers/kafka/consumers"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var consumeCommand = &cobra.Command{
+	Use:   "consume",
+	Short: "Consume order events and cancel the payments of cancelled orders",
+	Run: func(c *cobra.Command, args []string) {
+		db := bootstrap()
+		if config.Config.Kafka.OrderTopic == "" {
+			logrus.Fatal("kafka.orderTopic is not configured")
+		}
+
+		kafka := kafkaClient.NewKafkaRegistry(config.Config.Kafka)
+		defer closeKafka(kafka)
+		service := newServiceRegistry(db, kafka)
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		consumers.NewOrderConsumer(config.Config.Kafka, service).Run(ctx)
+	},
+}
+
+func init() {
+	command.AddCommand(consumeCommand)
+}
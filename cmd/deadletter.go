@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"os/signal"
+	"payment-service/config"
+	kafkaClient "payment-service/controllers/kafka"
+	"payment-service/controllers/kafka/consumers"
+	"payment-service/domain/dto"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	deadLetterSourceDB    = "db"
+	deadLetterSourceTopic = "topic"
+)
+
+var deadLetterCommand = &cobra.Command{
+	Use:   "deadletter",
+	Short: "Manage payment events that could not be published",
+}
+
+var deadLetterRedriveCommand = &cobra.Command{
+	Use:   "redrive",
+	Short: "Re-drive dead-lettered payment events",
+	Long: "Put dead-lettered payment events back into the outbox at their original position so that the relay publishes them, " +
+		"and the later events of their order after them, to their original topic again. " +
+		"Dead-lettered order events are handled again instead of being republished. " +
+		"--source db re-drives the events stored in the dead_letters table, --source topic consumes the dead-letter topic up to its end.",
+	Run: func(c *cobra.Command, args []string) {
+		source, _ := c.Flags().GetString("source")
+		id, _ := c.Flags().GetString("id")
+		if source != deadLetterSourceDB && source != deadLetterSourceTopic {
+			logrus.Fatalf("invalid --source %q, expected %s or %s", source, deadLetterSourceDB, deadLetterSourceTopic)
+		}
+		if id != "" && source != deadLetterSourceDB {
+			logrus.Fatalf("--id is only supported with --source %s", deadLetterSourceDB)
+		}
+
+		db := bootstrap()
+		if source == deadLetterSourceTopic && config.Config.Kafka.DeadLetterTopic == "" {
+			logrus.Fatal("no dead-letter topic is configured")
+		}
+
+		kafka := kafkaClient.NewKafkaRegistry(config.Config.Kafka)
+		defer closeKafka(kafka)
+		service := newServiceRegistry(db, kafka)
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		var (
+			redriven int
+			err      error
+		)
+		if source == deadLetterSourceTopic {
+			redriven, err = consumers.NewDeadLetterConsumer(config.Config.Kafka, service).Redrive(ctx)
+		} else {
+			param := &dto.DeadLetterRequestParam{}
+			if id != "" {
+				param.UUID = &id
+			}
+			redriven, err = service.GetOutbox().RedriveDeadLetters(ctx, param)
+		}
+		if err != nil {
+			logrus.Fatalf("failed to re-drive dead letters after %d: %v", redriven, err)
+		}
+
+		logrus.Infof("re-drove %d dead letters", redriven)
+	},
+}
+
+var deadLetterDiscardCommand = &cobra.Command{
+	Use:   "discard",
+	Short: "Give up on a dead-lettered payment event",
+	Long: "Give up on a dead outbox message for good. Until it is re-driven or discarded, " +
+		"a dead message holds back the later events of its order so that they are not published out of order.",
+	Run: func(c *cobra.Command, args []string) {
+		outboxID, _ := c.Flags().GetUint("outbox-id")
+		if outboxID == 0 {
+			logrus.Fatal("--outbox-id is required")
+		}
+
+		db := bootstrap()
+		kafka := kafkaClient.NewKafkaRegistry(config.Config.Kafka)
+		defer closeKafka(kafka)
+		service := newServiceRegistry(db, kafka)
+
+		err := service.GetOutbox().Discard(context.Background(), outboxID)
+		if err != nil {
+			logrus.Fatalf("failed to discard outbox message %d: %v", outboxID, err)
+		}
+
+		logrus.Infof("discarded outbox message %d", outboxID)
+	},
+}
+
+func init() {
+	deadLetterDiscardCommand.Flags().Uint("outbox-id", 0, "ID of the dead outbox message to discard")
+	deadLetterRedriveCommand.Flags().String("source", deadLetterSourceDB, "where to read dead letters from (db or topic)")
+	deadLetterRedriveCommand.Flags().String("id", "", "only re-drive the stored dead letter with this UUID")
+
+	deadLetterCommand.AddCommand(deadLetterRedriveCommand)
+	deadLetterCommand.AddCommand(deadLetterDiscardCommand)
+	command.AddCommand(deadLetterCommand)
+}
@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os/signal"
 	"payment-service/clients"
+	fakeClient "payment-service/clients/fake"
+	"payment-service/clients/gateway"
 	midtransClient "payment-service/clients/midtrans"
 	"payment-service/common/gcs"
 	"payment-service/common/response"
@@ -13,62 +18,71 @@ import (
 	"payment-service/constants"
 	controllers "payment-service/controllers/http"
 	kafkaClient "payment-service/controllers/kafka"
+	"payment-service/controllers/kafka/consumers"
 	"payment-service/domain/models"
 	"payment-service/middlewares"
 	"payment-service/repositories"
 	"payment-service/routes"
 	"payment-service/services"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 var command = &cobra.Command{
 	Use:   "serve",
 	Short: "Start the server",
 	Run: func(c *cobra.Command, args []string) {
-		_ = godotenv.Load()
-		config.Init()
+		db := bootstrap()
+		kafka := kafkaClient.NewKafkaRegistry(config.Config.Kafka)
+		client := clients.NewClientRegistry()
+		service := newServiceRegistry(db, kafka)
+		controller := controllers.NewControllerRegistry(service)
 
-		// Setup log
-		logrus.SetFormatter(&logrus.TextFormatter{
-			FullTimestamp: true,
-		})
-		logrus.SetLevel(logrus.DebugLevel)
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
 
-		db, err := config.InitDatabase()
-		if err != nil {
-			panic(err)
-		}
+		var workers sync.WaitGroup
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			service.GetOutbox().Run(ctx)
+		}()
 
-		loc, err := time.LoadLocation("Asia/Jakarta")
-		if err != nil {
-			panic(err)
+		if config.Config.Kafka.OrderTopic != "" {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				consumers.NewOrderConsumer(config.Config.Kafka, service).Run(ctx)
+			}()
 		}
-		time.Local = loc
 
-		err = db.AutoMigrate(
-			&models.Payment{},
-			&models.PaymentHistory{},
-		)
-		if err != nil {
-			panic(err)
-		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			service.GetPayment().RunExpirySweeper(ctx)
+		}()
 
-		gcs := InitGCS()
-		kafka := kafkaClient.NewKafkaRegistry(config.Config.Kafka.Brokers)
-		midtrans := midtransClient.NewMidtransClient(config.Config.Midtrans.ServerKey, config.Config.Midtrans.IsProduction)
-		client := clients.NewClientRegistry()
-		repository := repositories.NewRepositoryRegistry(db)
-		service := services.NewServiceRegistry(repository, gcs, kafka, midtrans)
-		controller := controllers.NewControllerRegistry(service)
+		if config.Config.Reconcile.IntervalInMinutes > 0 {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				service.GetPayment().RunReconciler(ctx)
+			}()
+		}
 
 		// ✅ Ganti gin.Default() → gin.New() agar HandlePanic() aktif
 		router := gin.New()
 		router.Use(middlewares.HandlePanic())
+		router.Use(middlewares.RequestID())
 		router.Use(gin.Logger())
 
 		router.NoRoute(func(c *gin.Context) {
@@ -89,7 +103,7 @@ var command = &cobra.Command{
 		router.Use(func(c *gin.Context) {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, DELETE, OPTIONS")
-			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, x-service-name, x-api-key, x-request-at")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, x-service-name, x-api-key, x-request-at, x-request-id, Idempotency-Key")
 			if c.Request.Method == "OPTIONS" {
 				c.AbortWithStatus(204)
 				return
@@ -109,11 +123,120 @@ var command = &cobra.Command{
 		route := routes.NewRouteRegistry(controller, group, client)
 		route.Serve()
 
-		port := fmt.Sprintf(":%d", config.Config.Port)
-		router.Run(port)
+		server := &http.Server{
+			Addr:    fmt.Sprintf(":%d", config.Config.Port),
+			Handler: router,
+		}
+
+		go func() {
+			err := server.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logrus.Fatalf("failed to start server: %v", err)
+			}
+		}()
+
+		<-ctx.Done()
+		logrus.Info("shutting down server")
+
+		// Stop accepting requests and let in-flight ones finish, then wait for
+		// the background workers before the Kafka producer is flushed and
+		// closed.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			logrus.Errorf("failed to shut down server: %v", err)
+		}
+
+		workers.Wait()
+		closeKafka(kafka)
 	},
 }
 
+// bootstrap loads the configuration, sets up logging and the timezone, then
+// connects to the database and migrates it. Every command starts with it.
+func bootstrap() *gorm.DB {
+	_ = godotenv.Load()
+	config.Init()
+
+	// Setup log
+	logrus.SetFormatter(&logrus.TextFormatter{
+		FullTimestamp: true,
+	})
+	logrus.SetLevel(logrus.DebugLevel)
+
+	db, err := config.InitDatabase()
+	if err != nil {
+		panic(err)
+	}
+
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		panic(err)
+	}
+	time.Local = loc
+
+	err = migrateAmountsToMinorUnits(db)
+	if err != nil {
+		panic(err)
+	}
+
+	err = checkDuplicateOrderIDs(db)
+	if err != nil {
+		panic(err)
+	}
+
+	err = db.AutoMigrate(
+		&models.Payment{},
+		&models.PaymentHistory{},
+		&models.WebhookEvent{},
+		&models.Outbox{},
+		&models.DeadLetter{},
+		&models.Refund{},
+		&models.IdempotencyKey{},
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	err = createSearchIndexes(db)
+	if err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
+func newServiceRegistry(db *gorm.DB, kafka kafkaClient.IKafkaRegistry) services.IServiceRegistry {
+	gcs := InitGCS()
+	repository := repositories.NewRepositoryRegistry(db)
+	return services.NewServiceRegistry(repository, gcs, kafka, newGatewayRegistry())
+}
+
+// newGatewayRegistry registers every payment gateway. The fake gateway is only
+// registered when it is the configured default, so that it can never be
+// selected in an environment running against real gateways.
+func newGatewayRegistry() gateway.IGatewayRegistry {
+	defaultProvider := constants.PaymentProvider(config.Config.PaymentGateway.DefaultProvider)
+	gateways := []gateway.IPaymentGateway{
+		midtransClient.NewMidtransClient(config.Config.Midtrans.ServerKey, config.Config.Midtrans.IsProduction),
+	}
+	if defaultProvider == constants.FakeProvider {
+		logrus.Warn("using the fake payment gateway, payments are not sent to any real gateway")
+		gateways = append(gateways, fakeClient.NewFakeClient())
+	}
+
+	return gateway.NewGatewayRegistry(defaultProvider, gateways...)
+}
+
+func closeKafka(kafka kafkaClient.IKafkaRegistry) {
+	err := kafka.Close()
+	if err != nil {
+		logrus.Errorf("failed to close kafka producer: %v", err)
+	}
+}
+
 func Run() {
 	err := command.Execute()
 	if err != nil {
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"payment-service/domain/models"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// migrateAmountsToMinorUnits converts the amount columns that still hold
+// floating-point rupiah into integer minor units, before AutoMigrate would
+// truncate them. Existing rows are rupiah, whose minor unit is the rupiah,
+// so every amount must be whole rupiah. Rows with a fractional amount fail
+// the migration with their IDs instead of being rounded, since a rounded
+// amount no longer matches what the gateway charged; they have to be fixed
+// by hand.
+func migrateAmountsToMinorUnits(db *gorm.DB) error {
+	for _, model := range []any{&models.Payment{}, &models.Refund{}} {
+		if !db.Migrator().HasTable(model) {
+			continue
+		}
+
+		columnTypes, err := db.Migrator().ColumnTypes(model)
+		if err != nil {
+			return err
+		}
+
+		for _, column := range columnTypes {
+			dataType := strings.ToLower(column.DatabaseTypeName())
+			if column.Name() != "amount" || dataType == "int8" || dataType == "bigint" {
+				continue
+			}
+
+			statement := &gorm.Statement{DB: db}
+			err = statement.Parse(model)
+			if err != nil {
+				return err
+			}
+
+			var ids []uint
+			err = db.Model(model).
+				Where("amount <> TRUNC(amount)").
+				Order("id").
+				Limit(20).
+				Pluck("id", &ids).
+				Error
+			if err != nil {
+				return err
+			}
+			if len(ids) > 0 {
+				return fmt.Errorf("%s rows %v hold fractional rupiah amounts; fix them before migrating amounts to integer minor units", statement.Table, ids)
+			}
+
+			logrus.Infof("migrating %s.amount from %s to integer minor units", statement.Table, dataType)
+			err = db.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN amount TYPE bigint USING amount::bigint", statement.Quote(statement.Table))).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// createSearchIndexes creates the indexes AutoMigrate cannot express, such as
+// the full-text index the payment list searches descriptions with.
+func createSearchIndexes(db *gorm.DB) error {
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_payments_description_search ON payments " +
+		"USING gin (to_tsvector('simple', coalesce(description, '')))").Error
+}
+
+// checkDuplicateOrderIDs fails with the duplicated order IDs when payments
+// still hold more than one payment for the same order, which the unique index
+// on order_id would otherwise fail on. They have to be resolved by hand, since
+// only one of them can be the payment of the order.
+func checkDuplicateOrderIDs(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.Payment{}) || db.Migrator().HasIndex(&models.Payment{}, "idx_payments_order_id") {
+		return nil
+	}
+
+	var orderIDs []string
+	err := db.Model(&models.Payment{}).
+		Select("order_id").
+		Group("order_id").
+		Having("COUNT(*) > 1").
+		Order("order_id").
+		Limit(20).
+		Pluck("order_id", &orderIDs).
+		Error
+	if err != nil {
+		return err
+	}
+
+	if len(orderIDs) > 0 {
+		return fmt.Errorf("payments hold more than one payment for orders %s; keep one payment per order before migrating", strings.Join(orderIDs, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"payment-service/config"
+	kafkaClient "payment-service/controllers/kafka"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var reconcileCommand = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Reconcile active payments with their payment gateway",
+	Long: "Query the payment gateway for the status of every active payment and apply the statuses that differ " +
+		"as if the missed notification had arrived. The resulting payment events are published by the outbox relay.",
+	Run: func(c *cobra.Command, args []string) {
+		db := bootstrap()
+		kafka := kafkaClient.NewKafkaRegistry(config.Config.Kafka)
+		defer closeKafka(kafka)
+		service := newServiceRegistry(db, kafka)
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		report, err := service.GetPayment().Reconcile(ctx)
+		for _, mismatch := range report.Mismatches {
+			line := fmt.Sprintf("%s\torder=%s\tprovider=%s\tlocal=%s\tgateway=%s",
+				mismatch.Result, mismatch.OrderID, mismatch.Provider, mismatch.LocalStatus, mismatch.GatewayStatus)
+			if mismatch.Error != "" {
+				line += fmt.Sprintf("\terror=%s", mismatch.Error)
+			}
+			fmt.Println(line)
+		}
+
+		logrus.Infof("reconciled %d payments: %d in sync, %d fixed, %d not found, %d conflicts, %d failed",
+			report.Checked, report.InSync, report.Fixed, report.NotFound, report.Conflicts, report.Failed)
+		if err != nil {
+			logrus.Fatalf("reconciliation stopped: %v", err)
+		}
+	},
+}
+
+func init() {
+	command.AddCommand(reconcileCommand)
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"context"
+	"os/signal"
+	"payment-service/config"
+	kafkaClient "payment-service/controllers/kafka"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var relayCommand = &cobra.Command{
+	Use:   "relay",
+	Short: "Publish pending outbox events to Kafka",
+	Run: func(c *cobra.Command, args []string) {
+		db := bootstrap()
+		kafka := kafkaClient.NewKafkaRegistry(config.Config.Kafka)
+		defer closeKafka(kafka)
+		service := newServiceRegistry(db, kafka)
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		service.GetOutbox().Run(ctx)
+	},
+}
+
+func init() {
+	command.AddCommand(relayCommand)
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"payment-service/config"
+	"payment-service/constants"
+	kafkaClient "payment-service/controllers/kafka"
+	"payment-service/domain/dto"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var webhookCommand = &cobra.Command{
+	Use:   "webhook",
+	Short: "Manage stored webhook notifications",
+}
+
+var webhookReplayCommand = &cobra.Command{
+	Use:   "replay",
+	Short: "Replay stored webhook notifications",
+	Long: "Re-feed stored webhook notifications through the webhook processing. " +
+		"Only notifications that were not processed successfully are replayed unless --include-processed is set.",
+	Run: func(c *cobra.Command, args []string) {
+		orderID, _ := c.Flags().GetString("order-id")
+		since, _ := c.Flags().GetString("since")
+		includeProcessed, _ := c.Flags().GetBool("include-processed")
+		if orderID == "" && since == "" {
+			logrus.Fatal("either --order-id or --since is required")
+		}
+
+		db := bootstrap()
+		kafka := kafkaClient.NewKafkaRegistry(config.Config.Kafka)
+		defer closeKafka(kafka)
+		service := newServiceRegistry(db, kafka)
+
+		param := &dto.WebhookEventRequestParam{}
+		if orderID != "" {
+			parsed, err := uuid.Parse(orderID)
+			if err != nil {
+				logrus.Fatalf("invalid --order-id: %v", err)
+			}
+			param.OrderID = &parsed
+		}
+		if since != "" {
+			parsed, err := parseSince(since)
+			if err != nil {
+				logrus.Fatalf("invalid --since: %v", err)
+			}
+			param.Since = &parsed
+		}
+		if !includeProcessed {
+			param.Statuses = []constants.WebhookEventStatus{
+				constants.WebhookEventReceived,
+				constants.WebhookEventFailed,
+			}
+		}
+
+		results, err := service.GetPayment().ReplayWebHooks(c.Context(), param)
+		if err != nil {
+			logrus.Fatalf("failed to replay webhooks: %v", err)
+		}
+
+		failed := 0
+		for _, result := range results {
+			line := fmt.Sprintf("%s order=%s status=%s result=%s", result.UUID, result.OrderID, result.TransactionStatus, result.Status)
+			if result.Status == constants.WebhookEventFailed {
+				failed++
+				if result.Error != nil {
+					line = fmt.Sprintf("%s error=%q", line, *result.Error)
+				}
+			}
+			fmt.Println(line)
+		}
+
+		logrus.Infof("replayed %d webhook notifications, %d failed", len(results), failed)
+	},
+}
+
+// parseSince accepts either an RFC 3339 timestamp or a plain date, which is
+// interpreted as midnight in the service timezone set up by bootstrap.
+func parseSince(value string) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return parsed, nil
+	}
+
+	return time.ParseInLocation(time.DateOnly, value, time.Local)
+}
+
+func init() {
+	webhookReplayCommand.Flags().String("order-id", "", "replay notifications of this order")
+	webhookReplayCommand.Flags().String("since", "", "replay notifications received since this time (RFC 3339 or YYYY-MM-DD)")
+	webhookReplayCommand.Flags().Bool("include-processed", false, "also replay notifications that were already processed")
+
+	webhookCommand.AddCommand(webhookReplayCommand)
+	command.AddCommand(webhookCommand)
+}
@@ -13,7 +13,10 @@ type ValidationResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
-var ErrValidator = map[string]string{}
+var ErrValidator = map[string]string{
+	"oneof":         "%s must be one of %s",
+	"excluded_with": "%s cannot be used together with %s",
+}
 
 func ErrValidationResponse(err error) (validationResponse []ValidationResponse) {
 	var fieldErrors validator.ValidationErrors
@@ -63,6 +66,6 @@ func ErrValidationResponse(err error) (validationResponse []ValidationResponse)
 }
 
 func WrapError(err error) error {
-	logrus.Error("error: %v", err)
+	logrus.Errorf("error: %v", err)
 	return err
 }
@@ -0,0 +1,96 @@
+// Package eventschema validates Kafka event payloads against the JSON Schemas
+// checked in under schemas/, which are also the contract shared with
+// consumers. Schemas are compiled with github.com/santhosh-tekuri/jsonschema
+// following the draft they declare, with formats asserted rather than treated
+// as annotations.
+package eventschema
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+//go:embed schemas/*.json
+var files embed.FS
+
+var (
+	ErrUnknownSchema = errors.New("unknown event schema")
+	ErrInvalidEvent  = errors.New("event does not match its schema")
+)
+
+var (
+	schemas   = map[string]*jsonschema.Schema{}
+	schemasMu sync.Mutex
+)
+
+// Load returns the schema of the given payment event version, e.g. "v2".
+func Load(version string) (*jsonschema.Schema, error) {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	if schema, ok := schemas[version]; ok {
+		return schema, nil
+	}
+
+	name := fmt.Sprintf("schemas/payment-event.%s.json", version)
+	content, err := files.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSchema, version)
+	}
+
+	schema, err := Compile(name, content)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", version, err)
+	}
+
+	schemas[version] = schema
+	return schema, nil
+}
+
+// Compile compiles a JSON Schema, failing when it is not a valid schema of
+// the draft it declares.
+func Compile(name string, content []byte) (*jsonschema.Schema, error) {
+	document, err := jsonschema.UnmarshalJSON(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	err = compiler.AddResource(name, document)
+	if err != nil {
+		return nil, err
+	}
+
+	return compiler.Compile(name)
+}
+
+// Validate checks a serialized payment event against the schema of the given
+// version.
+func Validate(version string, payload []byte) error {
+	schema, err := Load(version)
+	if err != nil {
+		return err
+	}
+
+	return validate(schema, payload)
+}
+
+func validate(schema *jsonschema.Schema, payload []byte) error {
+	value, err := jsonschema.UnmarshalJSON(bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	err = schema.Validate(value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package eventschema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompileRejectsInvalidSchema(t *testing.T) {
+	_, err := Compile("invalid.json", []byte(`{"$schema": "https://json-schema.org/draft/2020-12/schema", "type": "object", "required": "id"}`))
+	if err == nil {
+		t.Fatal("Compile() error = nil, want an invalid schema")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	for _, version := range []string{"v1", "v2"} {
+		_, err := Load(version)
+		if err != nil {
+			t.Errorf("Load(%q) error = %v", version, err)
+		}
+	}
+
+	_, err := Load("v0")
+	if !errors.Is(err, ErrUnknownSchema) {
+		t.Errorf("Load(%q) error = %v, want %v", "v0", err, ErrUnknownSchema)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile("test.json", []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"required": ["id", "status", "amount"],
+		"additionalProperties": false,
+		"properties": {
+			"id": {"type": "string", "format": "uuid"},
+			"version": {"const": "1.0"},
+			"status": {"enum": ["pending", "settlement"]},
+			"amount": {"type": "integer", "minimum": 0},
+			"source": {"type": "string", "minLength": 1},
+			"paid_at": {"type": ["string", "null"], "format": "date-time"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"code": {"type": "string", "pattern": "^[A-Z]{3}$"},
+			"method": {"oneOf": [{"const": "qris"}, {"const": "gopay"}]}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	const id = `"id": "0b7d2a55-2f6e-4bd3-9d4b-6a3f3f1c2a10"`
+	tests := []struct {
+		name    string
+		event   string
+		wantErr bool
+	}{
+		{name: "valid", event: `{` + id + `, "version": "1.0", "status": "pending", "amount": 150000, "source": "s", "paid_at": "2026-01-02T03:04:05+07:00", "tags": ["a"]}`},
+		{name: "null allowed by a type list", event: `{` + id + `, "status": "pending", "amount": 0, "paid_at": null}`},
+		{name: "missing required property", event: `{` + id + `, "status": "pending"}`, wantErr: true},
+		{name: "additional property", event: `{` + id + `, "status": "pending", "amount": 1, "extra": 1}`, wantErr: true},
+		{name: "wrong type", event: `{` + id + `, "status": "pending", "amount": "1"}`, wantErr: true},
+		{name: "number for integer", event: `{` + id + `, "status": "pending", "amount": 1.5}`, wantErr: true},
+		{name: "below minimum", event: `{` + id + `, "status": "pending", "amount": -1}`, wantErr: true},
+		{name: "not in enum", event: `{` + id + `, "status": "paid", "amount": 1}`, wantErr: true},
+		{name: "not the const", event: `{` + id + `, "version": "2.0", "status": "pending", "amount": 1}`, wantErr: true},
+		{name: "too short", event: `{` + id + `, "status": "pending", "amount": 1, "source": ""}`, wantErr: true},
+		{name: "invalid uuid", event: `{"id": "42", "status": "pending", "amount": 1}`, wantErr: true},
+		{name: "invalid date-time", event: `{` + id + `, "status": "pending", "amount": 1, "paid_at": "yesterday"}`, wantErr: true},
+		{name: "invalid item", event: `{` + id + `, "status": "pending", "amount": 1, "tags": [1]}`, wantErr: true},
+		{name: "matching pattern", event: `{` + id + `, "status": "pending", "amount": 1, "code": "IDR", "method": "qris"}`},
+		{name: "not matching pattern", event: `{` + id + `, "status": "pending", "amount": 1, "code": "idr"}`, wantErr: true},
+		{name: "matching no alternative", event: `{` + id + `, "status": "pending", "amount": 1, "method": "card"}`, wantErr: true},
+		{name: "malformed", event: `{`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(schema, []byte(tt.event))
+			if tt.wantErr && !errors.Is(err, ErrInvalidEvent) {
+				t.Fatalf("validate() error = %v, want %v", err, ErrInvalidEvent)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+		})
+	}
+}
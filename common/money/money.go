@@ -0,0 +1,102 @@
+package money
+
+import (
+	"fmt"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"strconv"
+	"strings"
+)
+
+// exponents holds the number of minor-unit digits of every supported
+// currency. Rupiah has no fractional unit in circulation and Midtrans only
+// accepts whole rupiah, so IDR amounts are counted in whole rupiah.
+var exponents = map[string]int{
+	constants.IDR: 0,
+}
+
+// Money is an amount in the minor units of its ISO 4217 currency. It is
+// embedded in models and DTOs, where it maps to the amount and currency
+// columns and JSON fields.
+type Money struct {
+	Amount   int64  `json:"amount" gorm:"type:bigint;not null"`
+	Currency string `json:"currency" gorm:"type:varchar(3);not null;default:'IDR'"`
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func IsSupported(currency string) bool {
+	_, ok := exponents[currency]
+	return ok
+}
+
+// Parse reads a decimal amount in major units, such as the "150000.00"
+// gateways send. Digits beyond the minor unit of the currency must be zero,
+// so that an amount is never silently rounded.
+func Parse(amount string, currency string) (Money, error) {
+	exponent, ok := exponents[currency]
+	if !ok {
+		return Money{}, errPayment.ErrUnsupportedCurrency
+	}
+
+	major, fraction, _ := strings.Cut(amount, ".")
+	if !isDigits(major) || (fraction != "" && !isDigits(fraction)) {
+		return Money{}, errPayment.ErrInvalidAmount
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > exponent {
+		return Money{}, errPayment.ErrInvalidAmount
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	value, err := strconv.ParseInt(major+fraction, 10, 64)
+	if err != nil {
+		return Money{}, errPayment.ErrInvalidAmount
+	}
+
+	return New(value, currency), nil
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits, so that
+// signs, spaces and exponents are rejected.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Exponent returns the number of minor-unit digits of the currency.
+func (m Money) Exponent() int {
+	return exponents[m.Currency]
+}
+
+// Split returns the amount in major units and the remaining minor units.
+func (m Money) Split() (int64, int64) {
+	factor := int64(1)
+	for range m.Exponent() {
+		factor *= 10
+	}
+	return m.Amount / factor, m.Amount % factor
+}
+
+// Decimal returns the amount in major units as a decimal string, e.g.
+// "150000" for IDR or "12.50" for a two-digit currency.
+func (m Money) Decimal() string {
+	major, minor := m.Split()
+	if m.Exponent() == 0 {
+		return fmt.Sprintf("%d", major)
+	}
+	return fmt.Sprintf("%d.%0*d", major, m.Exponent(), minor)
+}
+
+func (m Money) String() string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s", m.Currency, m.Decimal()))
+}
@@ -0,0 +1,98 @@
+package money
+
+import (
+	"errors"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"testing"
+)
+
+// withExponent registers a currency for the duration of the test, so that
+// currencies with a fractional unit can be covered while only IDR is
+// supported.
+func withExponent(t *testing.T, currency string, exponent int) {
+	t.Helper()
+	exponents[currency] = exponent
+	t.Cleanup(func() { delete(exponents, currency) })
+}
+
+func TestParse(t *testing.T) {
+	withExponent(t, "USD", 2)
+
+	tests := []struct {
+		amount   string
+		currency string
+		want     int64
+		wantErr  error
+	}{
+		{amount: "150000", currency: constants.IDR, want: 150000},
+		{amount: "150000.00", currency: constants.IDR, want: 150000},
+		{amount: "150000.", currency: constants.IDR, want: 150000},
+		{amount: "0", currency: constants.IDR, want: 0},
+		{amount: "150000.50", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: "150000.001", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: "12.5", currency: "USD", want: 1250},
+		{amount: "12.50", currency: "USD", want: 1250},
+		{amount: "12.500", currency: "USD", want: 1250},
+		{amount: "12", currency: "USD", want: 1200},
+		{amount: "0.01", currency: "USD", want: 1},
+		{amount: "12.505", currency: "USD", wantErr: errPayment.ErrInvalidAmount},
+		{amount: "", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: ".50", currency: "USD", wantErr: errPayment.ErrInvalidAmount},
+		{amount: "-1", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: "+1", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: "1e3", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: "1,000", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: " 1", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: "1.0.0", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: "1.-0", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: "99999999999999999999", currency: constants.IDR, wantErr: errPayment.ErrInvalidAmount},
+		{amount: "100", currency: "EUR", wantErr: errPayment.ErrUnsupportedCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency+" "+tt.amount, func(t *testing.T) {
+			got, err := Parse(tt.amount, tt.currency)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got != New(tt.want, tt.currency) {
+				t.Errorf("Parse() = %v, want %v", got, New(tt.want, tt.currency))
+			}
+		})
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	withExponent(t, "USD", 2)
+
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{money: New(150000, constants.IDR), want: "150000"},
+		{money: New(0, constants.IDR), want: "0"},
+		{money: New(1250, "USD"), want: "12.50"},
+		{money: New(1, "USD"), want: "0.01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got := tt.money.Decimal()
+			if got != tt.want {
+				t.Errorf("Decimal() = %q, want %q", got, tt.want)
+			}
+
+			parsed, err := Parse(got, tt.money.Currency)
+			if err != nil || parsed != tt.money {
+				t.Errorf("Parse(Decimal()) = %v, %v, want %v", parsed, err, tt.money)
+			}
+		})
+	}
+}
@@ -3,11 +3,15 @@ package util
 import (
 	"bytes"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"math"
 	"os"
+	"payment-service/common/money"
 	"reflect"
 	"strconv"
 	"strings"
@@ -20,16 +24,19 @@ import (
 	"github.com/spf13/viper"
 )
 
+// PaginationParams describes a page of Data. Without Count, the total is not
+// known and HasNext tells whether another page follows.
 type PaginationParams struct {
-	Count int64       `json:"count"`
-	Page  int         `json:"page"`
-	Limit int         `json:"limit"`
-	Data  interface{} `json:"data"`
+	Count   *int64      `json:"count"`
+	HasNext bool        `json:"hasNext"`
+	Page    int         `json:"page"`
+	Limit   int         `json:"limit"`
+	Data    interface{} `json:"data"`
 }
 
 type PaginationResult struct {
-	TotalPage    int         `json:"totalPage"`
-	TotalData    int64       `json:"totalData"`
+	TotalPage    *int        `json:"totalPage,omitempty"`
+	TotalData    *int64      `json:"totalData,omitempty"`
 	NextPage     *int        `json:"nextPage"`
 	PreviousPage *int        `json:"previousPage"`
 	Page         int         `json:"page"`
@@ -38,14 +45,20 @@ type PaginationResult struct {
 }
 
 func GeneratePagination(params PaginationParams) PaginationResult {
-	totalPage := int(math.Ceil(float64(params.Count) / float64(params.Limit)))
-
 	var (
+		totalPage    *int
 		nextPage     int
 		previousPage int
 	)
 
-	if params.Page < totalPage {
+	hasNext := params.HasNext
+	if params.Count != nil {
+		pages := int(math.Ceil(float64(*params.Count) / float64(params.Limit)))
+		totalPage = &pages
+		hasNext = params.Page < pages
+	}
+
+	if hasNext {
 		nextPage = params.Page + 1
 	}
 
@@ -66,6 +79,49 @@ func GeneratePagination(params PaginationParams) PaginationResult {
 	return result
 }
 
+type CursorPaginationParams struct {
+	Count      *int64
+	Limit      int
+	NextCursor *string
+	Data       interface{}
+}
+
+type CursorPaginationResult struct {
+	TotalData  *int64      `json:"totalData,omitempty"`
+	NextCursor *string     `json:"nextCursor"`
+	Limit      int         `json:"limit"`
+	Data       interface{} `json:"data"`
+}
+
+func GenerateCursorPagination(params CursorPaginationParams) CursorPaginationResult {
+	return CursorPaginationResult{
+		TotalData:  params.Count,
+		NextCursor: params.NextCursor,
+		Limit:      params.Limit,
+		Data:       params.Data,
+	}
+}
+
+// EncodeCursor encodes the position of a page into an opaque cursor.
+func EncodeCursor(position any) (string, error) {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor decodes a cursor made by EncodeCursor into position.
+func DecodeCursor(cursor string, position any) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, position)
+}
+
 func GenerateSHA256(input string) string {
 	hash := sha256.New()
 	hash.Write([]byte(input))
@@ -74,11 +130,24 @@ func GenerateSHA256(input string) string {
 	return hashString
 }
 
-func RupiahFormat(amount *float64) string {
+func GenerateSHA512(input string) string {
+	hash := sha512.New()
+	hash.Write([]byte(input))
+	hashBytes := hash.Sum(nil)
+	hashString := hex.EncodeToString(hashBytes)
+	return hashString
+}
+
+// RupiahFormat formats an amount with Indonesian thousand separators, e.g.
+// "Rp. 150.000". Minor units, if any, follow a decimal comma.
+func RupiahFormat(amount *money.Money) string {
 	stringValue := "0"
 	if amount != nil {
-		humanizeValue := humanize.CommafWithDigits(*amount, 0)
-		stringValue = strings.ReplaceAll(humanizeValue, ",", ".")
+		major, minor := amount.Split()
+		stringValue = strings.ReplaceAll(humanize.Comma(major), ",", ".")
+		if amount.Exponent() > 0 {
+			stringValue = fmt.Sprintf("%s,%0*d", stringValue, amount.Exponent(), minor)
+		}
 	}
 
 	return fmt.Sprintf("Rp. %s", stringValue)
@@ -0,0 +1,96 @@
+package util
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+type testCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        uint      `json:"id"`
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := testCursor{
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.FixedZone("WIB", 7*60*60)),
+		ID:        42,
+	}
+
+	cursor, err := EncodeCursor(want)
+	if err != nil {
+		t.Fatalf("EncodeCursor() error = %v", err)
+	}
+
+	var got testCursor
+	err = DecodeCursor(cursor, &got)
+	if err != nil {
+		t.Fatalf("DecodeCursor() error = %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Errorf("DecodeCursor() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "empty", cursor: ""},
+		{name: "not base64", cursor: "not a cursor!"},
+		{name: "standard base64 padding", cursor: base64.StdEncoding.EncodeToString([]byte(`{"id":1}`))},
+		{name: "not json", cursor: encode("id=1")},
+		{name: "truncated json", cursor: encode(`{"id":1`)},
+		{name: "trailing data", cursor: encode(`{"id":1}{"id":2}`)},
+		{name: "wrong type", cursor: encode(`{"id":"1"}`)},
+		{name: "negative id", cursor: encode(`{"id":-1}`)},
+		{name: "invalid time", cursor: encode(`{"created_at":"yesterday","id":1}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testCursor
+			err := DecodeCursor(tt.cursor, &got)
+			if err == nil {
+				t.Errorf("DecodeCursor(%q) = %+v, want an error", tt.cursor, got)
+			}
+		})
+	}
+}
+
+func TestGeneratePagination(t *testing.T) {
+	count := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name          string
+		params        PaginationParams
+		wantTotalPage int
+		wantNextPage  int
+		wantPrevPage  int
+	}{
+		{name: "counted first page", params: PaginationParams{Count: count(25), Page: 1, Limit: 10}, wantTotalPage: 3, wantNextPage: 2},
+		{name: "counted last page", params: PaginationParams{Count: count(25), Page: 3, Limit: 10}, wantTotalPage: 3, wantPrevPage: 2},
+		{name: "counted empty result", params: PaginationParams{Count: count(0), Page: 1, Limit: 10}},
+		{name: "uncounted page with more", params: PaginationParams{HasNext: true, Page: 2, Limit: 10}, wantNextPage: 3, wantPrevPage: 1},
+		{name: "uncounted last page", params: PaginationParams{Page: 2, Limit: 10}, wantPrevPage: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GeneratePagination(tt.params)
+			if tt.params.Count == nil {
+				if got.TotalPage != nil || got.TotalData != nil {
+					t.Errorf("GeneratePagination() totals = %v, %v, want none", got.TotalPage, got.TotalData)
+				}
+			} else if got.TotalPage == nil || *got.TotalPage != tt.wantTotalPage || got.TotalData != tt.params.Count {
+				t.Errorf("GeneratePagination() totals = %v, %v, want %d, %d", got.TotalPage, got.TotalData, tt.wantTotalPage, *tt.params.Count)
+			}
+			if *got.NextPage != tt.wantNextPage || *got.PreviousPage != tt.wantPrevPage {
+				t.Errorf("GeneratePagination() pages = %d, %d, want %d, %d", *got.NextPage, *got.PreviousPage, tt.wantNextPage, tt.wantPrevPage)
+			}
+		})
+	}
+}
@@ -24,6 +24,10 @@ type AppConfig struct {
 	GCSBucketName         string          `json:"gcsBucketName"`
 	Kafka                 Kafka           `json:"kafka"`
 	Midtrans              Midtrans        `json:"midtrans"`
+	PaymentGateway        PaymentGateway  `json:"paymentGateway"`
+	Outbox                Outbox          `json:"outbox"`
+	Reconcile             Reconcile       `json:"reconcile"`
+	Expiry                Expiry          `json:"expiry"`
 }
 
 type Database struct {
@@ -48,10 +52,37 @@ type User struct {
 }
 
 type Kafka struct {
-	Brokers     []string `json:"brokers"`
-	TimeoutInMs int      `json:"timeoutInMs"`
-	MaxRetry    int      `json:"maxRetry"`
-	Topic       string   `json:"topic"`
+	Brokers             []string `json:"brokers"`
+	TimeoutInMs         int      `json:"timeoutInMs"`
+	MaxRetry            int      `json:"maxRetry"`
+	Topic               string   `json:"topic"`
+	Async               bool     `json:"async"`
+	EventVersion        string   `json:"eventVersion"`
+	ConsumerGroup       string   `json:"consumerGroup"`
+	OrderTopic          string   `json:"orderTopic"`
+	DeadLetterTopic     string   `json:"deadLetterTopic"`
+	ConsumerMaxAttempts int      `json:"consumerMaxAttempts"`
+}
+
+type Outbox struct {
+	RelayIntervalInMs int `json:"relayIntervalInMs"`
+	BatchSize         int `json:"batchSize"`
+	MaxAttempts       int `json:"maxAttempts"`
+	ClaimTimeoutInMs  int `json:"claimTimeoutInMs"`
+}
+
+// Reconcile configures the reconciliation of payments against their gateway.
+// The in-process scheduler only runs when IntervalInMinutes is set.
+type Reconcile struct {
+	IntervalInMinutes int `json:"intervalInMinutes"`
+	LookbackInHours   int `json:"lookbackInHours"`
+	MinAgeInMinutes   int `json:"minAgeInMinutes"`
+	BatchSize         int `json:"batchSize"`
+}
+
+type Expiry struct {
+	SweepIntervalInSeconds int `json:"sweepIntervalInSeconds"`
+	BatchSize              int `json:"batchSize"`
 }
 
 type Midtrans struct {
@@ -60,6 +91,13 @@ type Midtrans struct {
 	IsProduction bool   `json:"isProduction"`
 }
 
+// PaymentGateway selects the provider of new payments. Setting the default
+// provider to "fake" runs the service against an offline gateway and enables
+// the sandbox endpoints.
+type PaymentGateway struct {
+	DefaultProvider string `json:"defaultProvider"`
+}
+
 func Init() {
 	err := util.BindFromJSON(&Config, "config.json", ".")
 	if err == nil {
@@ -0,0 +1,35 @@
+package constants
+
+// ChargeMethod is a payment method that can be charged directly, without the
+// customer going through a hosted payment page.
+type ChargeMethod string
+
+const (
+	BCAVirtualAccount     ChargeMethod = "bca_va"
+	BNIVirtualAccount     ChargeMethod = "bni_va"
+	BRIVirtualAccount     ChargeMethod = "bri_va"
+	PermataVirtualAccount ChargeMethod = "permata_va"
+	EChannel              ChargeMethod = "echannel"
+	QRIS                  ChargeMethod = "qris"
+	GoPay                 ChargeMethod = "gopay"
+	ShopeePay             ChargeMethod = "shopeepay"
+)
+
+var chargeMethods = map[ChargeMethod]bool{
+	BCAVirtualAccount:     true,
+	BNIVirtualAccount:     true,
+	BRIVirtualAccount:     true,
+	PermataVirtualAccount: true,
+	EChannel:              true,
+	QRIS:                  true,
+	GoPay:                 true,
+	ShopeePay:             true,
+}
+
+func (c ChargeMethod) String() string {
+	return string(c)
+}
+
+func (c ChargeMethod) IsValid() bool {
+	return chargeMethods[c]
+}
@@ -11,6 +11,7 @@ var (
 	ErrForbidden           = errors.New("forbidden")
 	ErrInvalidUploadFile   = errors.New("invalid upload file")
 	ErrSizeTooLarge        = errors.New("size too large")
+	ErrBrokerUnavailable   = errors.New("message broker is unavailable")
 )
 
 var GeneralErrrors = []error{
@@ -22,4 +23,5 @@ var GeneralErrrors = []error{
 	ErrForbidden,
 	ErrInvalidUploadFile,
 	ErrSizeTooLarge,
+	ErrBrokerUnavailable,
 }
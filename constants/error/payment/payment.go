@@ -1,13 +1,75 @@
 package error
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"payment-service/constants"
+	"strings"
+)
 
 var (
-	ErrPaymentNotFound  = errors.New("payment not found")
-	ErrExpiredAtInvalid = errors.New("expired time must be greater than current time")
+	ErrPaymentNotFound     = errors.New("payment not found")
+	ErrExpiredAtInvalid    = errors.New("expired time must be greater than current time")
+	ErrInvalidSignature    = errors.New("invalid notification signature")
+	ErrInvalidStatus       = errors.New("invalid payment status")
+	ErrItemAmountMismatch  = errors.New("total of item details does not match the payment amount")
+	ErrInvalidChargeMethod = errors.New("unsupported payment method")
+	ErrRefundNotAllowed    = errors.New("payment cannot be refunded in its current status")
+	ErrRefundExceedsPaid   = errors.New("refund total exceeds the paid amount")
+	ErrRefundNotFound      = errors.New("refund not found")
+	ErrRefundDeclined      = errors.New("refund was declined by the payment gateway")
+	ErrRefundMustBeFull    = errors.New("a payment held for review can only be refunded in full")
+	ErrPaymentAlreadyPaid  = errors.New("payment is already paid, refund it instead")
+	ErrCancelNotAllowed    = errors.New("payment cannot be cancelled in its current status")
+	ErrPaymentExists       = errors.New("payment for this order already exists")
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrInvalidAmount       = errors.New("invalid amount")
+	ErrInvalidFilter       = errors.New("invalid payment filter, ranges must not be empty")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrCursorSort          = errors.New("sort is not supported with cursor pagination, payments are ordered newest first")
+	ErrInvalidSort         = fmt.Errorf("invalid sort, allowed fields are %s, prefixed with - to sort descending", strings.Join(constants.PaymentSortFieldNames(), ", "))
+
+	ErrWebhookEventNotFound       = errors.New("webhook event not found")
+	ErrGatewayTransactionNotFound = errors.New("transaction not found at payment gateway")
+	ErrGatewayRejected            = errors.New("payment gateway rejected the request")
+	ErrUnsupportedProvider        = errors.New("unsupported payment provider")
+	ErrProviderMismatch           = errors.New("notification provider does not match the payment provider")
+	ErrSimulationNotSupported     = errors.New("payment provider does not support simulated notifications")
+	ErrIdempotencyKeyMismatch     = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress   = errors.New("a request with this idempotency key is still being processed")
+	ErrDeadLetterNotFound         = errors.New("no dead outbox message with this ID")
+	ErrUnknownDeadLetterTopic     = errors.New("no handler for dead letters consumed from this topic")
 )
 
 var PaymentError = []error{
 	ErrPaymentNotFound,
 	ErrExpiredAtInvalid,
+	ErrInvalidSignature,
+	ErrInvalidStatus,
+	ErrItemAmountMismatch,
+	ErrInvalidChargeMethod,
+	ErrRefundNotAllowed,
+	ErrRefundExceedsPaid,
+	ErrRefundNotFound,
+	ErrRefundDeclined,
+	ErrRefundMustBeFull,
+	ErrPaymentAlreadyPaid,
+	ErrCancelNotAllowed,
+	ErrPaymentExists,
+	ErrUnsupportedCurrency,
+	ErrInvalidAmount,
+	ErrInvalidFilter,
+	ErrInvalidSort,
+	ErrInvalidCursor,
+	ErrCursorSort,
+	ErrWebhookEventNotFound,
+	ErrGatewayTransactionNotFound,
+	ErrGatewayRejected,
+	ErrUnsupportedProvider,
+	ErrProviderMismatch,
+	ErrSimulationNotSupported,
+	ErrIdempotencyKeyMismatch,
+	ErrIdempotencyKeyInProgress,
+	ErrDeadLetterNotFound,
+	ErrUnknownDeadLetterTopic,
 }
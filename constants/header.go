@@ -3,8 +3,10 @@ package constants
 import "net/textproto"
 
 var (
-	XServiceName  = textproto.CanonicalMIMEHeaderKey("x-service-name")
-	XApiKey       = textproto.CanonicalMIMEHeaderKey("x-api-key")
-	XRequestAt    = textproto.CanonicalMIMEHeaderKey("x-request-at")
-	Authorization = textproto.CanonicalMIMEHeaderKey("Authorization")
+	XServiceName   = textproto.CanonicalMIMEHeaderKey("x-service-name")
+	XApiKey        = textproto.CanonicalMIMEHeaderKey("x-api-key")
+	XRequestAt     = textproto.CanonicalMIMEHeaderKey("x-request-at")
+	Authorization  = textproto.CanonicalMIMEHeaderKey("Authorization")
+	XRequestID     = textproto.CanonicalMIMEHeaderKey("x-request-id")
+	IdempotencyKey = textproto.CanonicalMIMEHeaderKey("Idempotency-Key")
 )
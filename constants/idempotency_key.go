@@ -0,0 +1,31 @@
+package constants
+
+import "time"
+
+type IdempotencyKeyStatus string
+
+const (
+	IdempotencyKeyProcessing IdempotencyKeyStatus = "processing"
+	IdempotencyKeyCompleted  IdempotencyKeyStatus = "completed"
+)
+
+// IdempotencyScopeCreatePayment scopes the idempotency keys of POST /payments.
+const IdempotencyScopeCreatePayment = "payments.create"
+
+// IdempotencyScopeChargePayment scopes the idempotency keys of
+// POST /payments/charge.
+const IdempotencyScopeChargePayment = "payments.charge"
+
+// IdempotencyKeyLease is how long a request holds its idempotency key while
+// processing. A key left processing longer, e.g. by a crashed process, is
+// taken over by the next request with the same key.
+const IdempotencyKeyLease = 2 * time.Minute
+
+// IdempotencyKeyTTL is how long an idempotency key is kept. A key reused after
+// it expired starts a new request, and the expiry sweeper deletes expired
+// keys.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+func (i IdempotencyKeyStatus) String() string {
+	return string(i)
+}
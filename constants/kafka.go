@@ -0,0 +1,18 @@
+package constants
+
+const (
+	KafkaSender = "payment-service"
+
+	KafkaHeaderEventName     = "event-name"
+	KafkaHeaderSchemaVersion = "schema-version"
+	KafkaHeaderSender        = "sender"
+	KafkaHeaderCorrelationID = "correlation-id"
+
+	KafkaEventVersionV1 = "v1"
+	KafkaEventVersionV2 = "v2"
+
+	OrderCancelledEvent = "CANCELLED"
+
+	CloudEventsSpecVersion = "1.0"
+	PaymentEventSchemaV2   = "urn:payment-service:payment-event:v2"
+)
@@ -0,0 +1,19 @@
+package constants
+
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "pending"
+	OutboxSent      OutboxStatus = "sent"
+	OutboxDead      OutboxStatus = "dead"
+	OutboxDiscarded OutboxStatus = "discarded"
+)
+
+// OutboxRelayLock is the Postgres advisory lock held by the relay publishing
+// a batch, so that only one relay publishes at a time across every replica
+// and the relay command.
+const OutboxRelayLock int64 = 7_311_003_101
+
+func (o OutboxStatus) String() string {
+	return string(o)
+}
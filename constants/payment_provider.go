@@ -0,0 +1,14 @@
+package constants
+
+type PaymentProvider string
+
+const (
+	MidtransProvider PaymentProvider = "midtrans"
+	FakeProvider     PaymentProvider = "fake"
+
+	DefaultPaymentProvider = MidtransProvider
+)
+
+func (p PaymentProvider) String() string {
+	return string(p)
+}
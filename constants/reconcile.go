@@ -0,0 +1,13 @@
+package constants
+
+type ReconcileResult string
+
+const (
+	ReconcileFixed    ReconcileResult = "fixed"
+	ReconcileConflict ReconcileResult = "conflict"
+	ReconcileFailed   ReconcileResult = "failed"
+)
+
+func (r ReconcileResult) String() string {
+	return string(r)
+}
@@ -0,0 +1,16 @@
+package constants
+
+// RefundStatus tracks a refund through its gateway call. A refund is stored
+// as pending before the gateway is called, so that a retry reuses its refund
+// key instead of refunding twice.
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"
+	RefundSucceeded RefundStatus = "succeeded"
+	RefundFailed    RefundStatus = "failed"
+)
+
+func (r RefundStatus) String() string {
+	return string(r)
+}
@@ -0,0 +1,22 @@
+package constants
+
+import (
+	"maps"
+	"slices"
+)
+
+// PaymentSortFields maps the fields payments can be sorted by to their
+// columns. Only these ever reach ORDER BY.
+var PaymentSortFields = map[string]string{
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"paid_at":    "paid_at",
+	"expired_at": "expired_at",
+	"amount":     "amount",
+	"status":     "status",
+}
+
+// PaymentSortFieldNames returns the sortable fields in alphabetical order.
+func PaymentSortFieldNames() []string {
+	return slices.Sorted(maps.Keys(PaymentSortFields))
+}
@@ -1,32 +1,97 @@
 package constants
 
+import "slices"
+
 type PaymentStatus int
 type PaymentStatusString string
+type FraudStatus string
 
 const (
-	Initial    PaymentStatus = 0
-	Pending    PaymentStatus = 100
-	Settlement PaymentStatus = 200
-	Expire     PaymentStatus = 300
-
-	InitialString    PaymentStatusString = "initial"
-	PendingString    PaymentStatusString = "pending"
-	SettlementString PaymentStatusString = "settlement"
-	ExpireString     PaymentStatusString = "expire"
+	Initial       PaymentStatus = 0
+	Pending       PaymentStatus = 100
+	Authorize     PaymentStatus = 110
+	Capture       PaymentStatus = 120
+	Settlement    PaymentStatus = 200
+	Expire        PaymentStatus = 300
+	Cancel        PaymentStatus = 310
+	Deny          PaymentStatus = 320
+	Failure       PaymentStatus = 330
+	Refund        PaymentStatus = 400
+	PartialRefund PaymentStatus = 410
+	Chargeback    PaymentStatus = 500
+	NeedsReview   PaymentStatus = 600
+
+	InitialString       PaymentStatusString = "initial"
+	PendingString       PaymentStatusString = "pending"
+	AuthorizeString     PaymentStatusString = "authorize"
+	CaptureString       PaymentStatusString = "capture"
+	SettlementString    PaymentStatusString = "settlement"
+	ExpireString        PaymentStatusString = "expire"
+	CancelString        PaymentStatusString = "cancel"
+	DenyString          PaymentStatusString = "deny"
+	FailureString       PaymentStatusString = "failure"
+	RefundString        PaymentStatusString = "refund"
+	PartialRefundString PaymentStatusString = "partial_refund"
+	ChargebackString    PaymentStatusString = "chargeback"
+	NeedsReviewString   PaymentStatusString = "needs_review"
+
+	FraudAccept    FraudStatus = "accept"
+	FraudChallenge FraudStatus = "challenge"
+	FraudDeny      FraudStatus = "deny"
 )
 
 var mapStatusStringtoINT = map[PaymentStatusString]PaymentStatus{
-	InitialString:    Initial,
-	PendingString:    Pending,
-	SettlementString: Settlement,
-	ExpireString:     Expire,
+	InitialString:       Initial,
+	PendingString:       Pending,
+	AuthorizeString:     Authorize,
+	CaptureString:       Capture,
+	SettlementString:    Settlement,
+	ExpireString:        Expire,
+	CancelString:        Cancel,
+	DenyString:          Deny,
+	FailureString:       Failure,
+	RefundString:        Refund,
+	PartialRefundString: PartialRefund,
+	ChargebackString:    Chargeback,
+	NeedsReviewString:   NeedsReview,
 }
 
 var mapStatusIntToString = map[PaymentStatus]PaymentStatusString{
-	Initial:    InitialString,
-	Pending:    PendingString,
-	Settlement: SettlementString,
-	Expire:     ExpireString,
+	Initial:       InitialString,
+	Pending:       PendingString,
+	Authorize:     AuthorizeString,
+	Capture:       CaptureString,
+	Settlement:    SettlementString,
+	Expire:        ExpireString,
+	Cancel:        CancelString,
+	Deny:          DenyString,
+	Failure:       FailureString,
+	Refund:        RefundString,
+	PartialRefund: PartialRefundString,
+	Chargeback:    ChargebackString,
+	NeedsReview:   NeedsReviewString,
+}
+
+// paymentStatusTransitions lists, for every status, the statuses a payment
+// may move to next. Final statuses have no outgoing transitions. A payment
+// whose paid amount does not match is held in needs_review instead of being
+// settled, until it is refunded through the refund API, or cancelled or
+// charged back at the gateway. A card capture challenged by fraud detection
+// is held as authorize until the merchant accepts or denies it.
+var paymentStatusTransitions = map[PaymentStatus][]PaymentStatus{
+	Initial:       {Pending, Authorize, Capture, Settlement, Expire, Cancel, Deny, Failure, NeedsReview},
+	Pending:       {Authorize, Capture, Settlement, Expire, Cancel, Deny, Failure, NeedsReview},
+	Authorize:     {Capture, Settlement, Expire, Cancel, Deny, Failure, NeedsReview},
+	Capture:       {Settlement, Cancel, Deny, Refund, PartialRefund, Chargeback, NeedsReview},
+	Settlement:    {Refund, PartialRefund, Chargeback},
+	PartialRefund: {PartialRefund, Refund, Chargeback},
+	NeedsReview:   {Cancel, Refund, Chargeback},
+	Expire:        {},
+	Cancel:        {},
+	Deny:          {},
+	Failure:       {},
+	Refund:        {},
+	Chargeback:    {},
 }
 
 func (p PaymentStatusString) String() string {
@@ -44,3 +109,38 @@ func (p PaymentStatus) GetStatusString() PaymentStatusString {
 func (p PaymentStatusString) GetStatusInt() PaymentStatus {
 	return mapStatusStringtoINT[p]
 }
+
+func (p PaymentStatusString) IsValid() bool {
+	_, ok := mapStatusStringtoINT[p]
+	return ok
+}
+
+func (p PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+	for _, status := range paymentStatusTransitions[p] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
+func (p PaymentStatus) IsFinal() bool {
+	return len(paymentStatusTransitions[p]) == 0
+}
+
+// ActiveStatuses returns, in ascending order, the statuses of payments that
+// are still waiting for the customer to pay, i.e. can still be settled.
+func ActiveStatuses() []PaymentStatus {
+	statuses := make([]PaymentStatus, 0, len(paymentStatusTransitions))
+	for status := range mapStatusIntToString {
+		if status.CanTransitionTo(Settlement) {
+			statuses = append(statuses, status)
+		}
+	}
+	slices.Sort(statuses)
+	return statuses
+}
+
+func (f FraudStatus) String() string {
+	return string(f)
+}
@@ -0,0 +1,71 @@
+package constants
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from PaymentStatus
+		to   PaymentStatus
+		want bool
+	}{
+		{from: Initial, to: Pending, want: true},
+		{from: Pending, to: Settlement, want: true},
+		{from: Pending, to: NeedsReview, want: true},
+		{from: Pending, to: Refund, want: false},
+		{from: Pending, to: Pending, want: false},
+		{from: Authorize, to: Capture, want: true},
+		{from: Capture, to: Refund, want: true},
+		{from: Settlement, to: Refund, want: true},
+		{from: Settlement, to: PartialRefund, want: true},
+		{from: Settlement, to: Chargeback, want: true},
+		{from: Settlement, to: Pending, want: false},
+		{from: Settlement, to: Expire, want: false},
+		{from: PartialRefund, to: PartialRefund, want: true},
+		{from: PartialRefund, to: Refund, want: true},
+		{from: PartialRefund, to: Settlement, want: false},
+		{from: NeedsReview, to: Refund, want: true},
+		{from: NeedsReview, to: Cancel, want: true},
+		{from: NeedsReview, to: Settlement, want: false},
+		{from: NeedsReview, to: PartialRefund, want: false},
+		{from: Expire, to: Settlement, want: false},
+		{from: Refund, to: PartialRefund, want: false},
+		{from: Chargeback, to: Refund, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from.GetStatusString().String()+"_to_"+tt.to.GetStatusString().String(), func(t *testing.T) {
+			got := tt.from.CanTransitionTo(tt.to)
+			if got != tt.want {
+				t.Errorf("CanTransitionTo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	final := []PaymentStatus{Expire, Cancel, Deny, Failure, Refund, Chargeback}
+	for status := range mapStatusIntToString {
+		want := slices.Contains(final, status)
+		if status.IsFinal() != want {
+			t.Errorf("%s.IsFinal() = %v, want %v", status.GetStatusString(), status.IsFinal(), want)
+		}
+		if want {
+			for next := range mapStatusIntToString {
+				if status.CanTransitionTo(next) {
+					t.Errorf("final status %s can move to %s", status.GetStatusString(), next.GetStatusString())
+				}
+			}
+		}
+	}
+}
+
+func TestActiveStatuses(t *testing.T) {
+	want := []PaymentStatus{Initial, Pending, Authorize, Capture}
+	got := ActiveStatuses()
+	if !slices.Equal(got, want) {
+		t.Errorf("ActiveStatuses() = %v, want %v", got, want)
+	}
+}
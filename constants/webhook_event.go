@@ -0,0 +1,13 @@
+package constants
+
+type WebhookEventStatus string
+
+const (
+	WebhookEventReceived  WebhookEventStatus = "received"
+	WebhookEventProcessed WebhookEventStatus = "processed"
+	WebhookEventFailed    WebhookEventStatus = "failed"
+)
+
+func (w WebhookEventStatus) String() string {
+	return string(w)
+}
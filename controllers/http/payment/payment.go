@@ -1,13 +1,14 @@
 package controllers
 
 import (
-	"fmt"
-	"io"
+	"errors"
 	"net/http"
 	"payment-service/common/response"
+	"payment-service/constants"
+	errConstant "payment-service/constants/error"
+	errPayment "payment-service/constants/error/payment"
 	"payment-service/domain/dto"
 	"payment-service/services"
-	"strings"
 
 	errValidation "payment-service/common/error"
 
@@ -23,7 +24,12 @@ type IPaymentController interface {
 	GetAllWithPagination(*gin.Context)
 	GetByUUID(*gin.Context)
 	Create(*gin.Context)
+	Charge(*gin.Context)
 	Webhook(*gin.Context)
+	ReplayWebhook(*gin.Context)
+	Simulate(*gin.Context)
+	Refund(*gin.Context)
+	Cancel(*gin.Context)
 }
 
 func NewPaymentController(service services.IServiceRegistry) IPaymentController {
@@ -60,7 +66,12 @@ func (p *PaymentController) GetAllWithPagination(c *gin.Context) {
 		return
 	}
 
-	result, err := p.service.GetPayment().GetAllWithPagination(c.Request.Context(), &param)
+	var result any
+	if param.Cursor != nil {
+		result, err = p.service.GetPayment().GetAllWithCursor(c.Request.Context(), &param)
+	} else {
+		result, err = p.service.GetPayment().GetAllWithPagination(c.Request.Context(), &param)
+	}
 	if err != nil {
 		response.HttpResponse(response.ParamHTTPResp{
 			Code: http.StatusBadRequest,
@@ -128,7 +139,35 @@ func (p *PaymentController) Create(c *gin.Context) {
 		return
 	}
 
+	req.IdempotencyKey = c.GetHeader(constants.IdempotencyKey)
 	result, err := p.service.GetPayment().Create(c.Request.Context(), &req)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errPayment.ErrIdempotencyKeyMismatch) ||
+			errors.Is(err, errPayment.ErrIdempotencyKeyInProgress) ||
+			errors.Is(err, errPayment.ErrPaymentExists) {
+			code = http.StatusConflict
+		}
+
+		response.HttpResponse(response.ParamHTTPResp{
+			Code: code,
+			Err:  err,
+			Gin:  c,
+		})
+
+		return
+	}
+
+	response.HttpResponse(response.ParamHTTPResp{
+		Code: http.StatusCreated,
+		Data: result,
+		Gin:  c,
+	})
+}
+
+func (p *PaymentController) Charge(c *gin.Context) {
+	var req dto.ChargeRequest
+	err := c.ShouldBindJSON(&req)
 	if err != nil {
 		response.HttpResponse(response.ParamHTTPResp{
 			Code: http.StatusBadRequest,
@@ -139,6 +178,40 @@ func (p *PaymentController) Create(c *gin.Context) {
 		return
 	}
 
+	validate := validator.New()
+	if err = validate.Struct(req); err != nil {
+		errMessage := http.StatusText(http.StatusUnprocessableEntity)
+		errorResponse := errValidation.ErrValidationResponse(err)
+		response.HttpResponse(response.ParamHTTPResp{
+			Err:     err,
+			Code:    http.StatusUnprocessableEntity,
+			Message: &errMessage,
+			Data:    errorResponse,
+			Gin:     c,
+		})
+
+		return
+	}
+
+	req.IdempotencyKey = c.GetHeader(constants.IdempotencyKey)
+	result, err := p.service.GetPayment().Charge(c.Request.Context(), &req)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errPayment.ErrIdempotencyKeyMismatch) ||
+			errors.Is(err, errPayment.ErrIdempotencyKeyInProgress) ||
+			errors.Is(err, errPayment.ErrPaymentExists) {
+			code = http.StatusConflict
+		}
+
+		response.HttpResponse(response.ParamHTTPResp{
+			Code: code,
+			Err:  err,
+			Gin:  c,
+		})
+
+		return
+	}
+
 	response.HttpResponse(response.ParamHTTPResp{
 		Code: http.StatusCreated,
 		Data: result,
@@ -147,48 +220,175 @@ func (p *PaymentController) Create(c *gin.Context) {
 }
 
 func (p *PaymentController) Webhook(c *gin.Context) {
-	// Debug: Log raw request body
 	body, _ := c.GetRawData()
-	fmt.Printf("=== RAW WEBHOOK REQUEST ===\n")
-	fmt.Printf("Method: %s\n", c.Request.Method)
-	fmt.Printf("Headers: %+v\n", c.Request.Header)
-	fmt.Printf("Content-Type: %s\n", c.GetHeader("Content-Type"))
-	fmt.Printf("Body: %s\n", string(body))
-	fmt.Printf("Body Length: %d\n", len(body))
-	fmt.Printf("========================\n")
-
-	// Reset body untuk parsing
-	c.Request.Body = io.NopCloser(strings.NewReader(string(body)))
-
-	var request dto.WebHook
-	err := c.ShouldBindJSON(&request)
+
+	// The path without a provider is the one Midtrans is configured with.
+	provider := constants.PaymentProvider(c.Param("provider"))
+	if provider == "" {
+		provider = constants.MidtransProvider
+	}
+
+	err := p.service.GetPayment().WebHook(c.Request.Context(), provider, body)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errPayment.ErrInvalidSignature) {
+			code = http.StatusUnauthorized
+		}
+
+		response.HttpResponse(response.ParamHTTPResp{
+			Code: code,
+			Err:  err,
+			Gin:  c,
+		})
+		return
+	}
+
+	response.HttpResponse(response.ParamHTTPResp{
+		Code: http.StatusOK,
+		Gin:  c,
+	})
+}
+
+func (p *PaymentController) ReplayWebhook(c *gin.Context) {
+	id := c.Param("id")
+	result, err := p.service.GetPayment().ReplayWebHook(c.Request.Context(), id)
+	if err != nil {
+		response.HttpResponse(response.ParamHTTPResp{
+			Code: http.StatusBadRequest,
+			Err:  err,
+			Gin:  c,
+		})
+
+		return
+	}
+
+	response.HttpResponse(response.ParamHTTPResp{
+		Code: http.StatusOK,
+		Data: result,
+		Gin:  c,
+	})
+}
+
+func (p *PaymentController) Simulate(c *gin.Context) {
+	var request dto.SimulatePaymentRequest
+	err := c.ShouldBindQuery(&request)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to bind JSON: %v\n", err)
-		fmt.Printf("ERROR Type: %T\n", err)
+		response.HttpResponse(response.ParamHTTPResp{
+			Code: http.StatusBadRequest,
+			Err:  err,
+			Gin:  c,
+		})
+
+		return
+	}
 
+	validate := validator.New()
+	if err = validate.Struct(request); err != nil {
+		errMessage := http.StatusText(http.StatusUnprocessableEntity)
+		errorResponse := errValidation.ErrValidationResponse(err)
+		response.HttpResponse(response.ParamHTTPResp{
+			Err:     err,
+			Code:    http.StatusUnprocessableEntity,
+			Message: &errMessage,
+			Data:    errorResponse,
+			Gin:     c,
+		})
+
+		return
+	}
+
+	result, err := p.service.GetPayment().Simulate(c.Request.Context(), c.Param("uuid"), &request)
+	if err != nil {
 		response.HttpResponse(response.ParamHTTPResp{
 			Code: http.StatusBadRequest,
 			Err:  err,
 			Gin:  c,
 		})
+
 		return
 	}
 
-	fmt.Printf("Successfully parsed webhook request: %+v\n", request)
+	response.HttpResponse(response.ParamHTTPResp{
+		Code: http.StatusOK,
+		Data: result,
+		Gin:  c,
+	})
+}
 
-	err = p.service.GetPayment().WebHook(c.Request.Context(), &request)
+func (p *PaymentController) Refund(c *gin.Context) {
+	var request dto.CreateRefundRequest
+	err := c.ShouldBindJSON(&request)
 	if err != nil {
-		fmt.Printf("ERROR: Webhook service failed: %v\n", err)
 		response.HttpResponse(response.ParamHTTPResp{
 			Code: http.StatusBadRequest,
 			Err:  err,
 			Gin:  c,
 		})
+
+		return
+	}
+
+	validate := validator.New()
+	if err = validate.Struct(request); err != nil {
+		errMessage := http.StatusText(http.StatusUnprocessableEntity)
+		errorResponse := errValidation.ErrValidationResponse(err)
+		response.HttpResponse(response.ParamHTTPResp{
+			Err:     err,
+			Code:    http.StatusUnprocessableEntity,
+			Message: &errMessage,
+			Data:    errorResponse,
+			Gin:     c,
+		})
+
+		return
+	}
+
+	request.IdempotencyKey = c.GetHeader(constants.IdempotencyKey)
+	result, err := p.service.GetPayment().Refund(c.Request.Context(), c.Param("uuid"), &request)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errPayment.ErrIdempotencyKeyMismatch) {
+			code = http.StatusConflict
+		}
+
+		response.HttpResponse(response.ParamHTTPResp{
+			Code: code,
+			Err:  err,
+			Gin:  c,
+		})
+
+		return
+	}
+
+	response.HttpResponse(response.ParamHTTPResp{
+		Code: http.StatusCreated,
+		Data: result,
+		Gin:  c,
+	})
+}
+
+func (p *PaymentController) Cancel(c *gin.Context) {
+	result, err := p.service.GetPayment().Cancel(c.Request.Context(), c.Param("uuid"))
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errConstant.ErrUnauthorized) {
+			code = http.StatusUnauthorized
+		} else if errors.Is(err, errConstant.ErrForbidden) {
+			code = http.StatusForbidden
+		}
+
+		response.HttpResponse(response.ParamHTTPResp{
+			Code: code,
+			Err:  err,
+			Gin:  c,
+		})
+
 		return
 	}
 
 	response.HttpResponse(response.ParamHTTPResp{
 		Code: http.StatusOK,
+		Data: result,
 		Gin:  c,
 	})
 }
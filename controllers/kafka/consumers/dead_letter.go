@@ -0,0 +1,172 @@
+package consumers
+
+import (
+	"context"
+	"encoding/json"
+	"payment-service/config"
+	"payment-service/domain/dto"
+	"payment-service/services"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// redriveIdleTimeout is how long a partition may stay silent before it is
+// considered caught up, e.g. when its remaining messages were removed by
+// retention.
+const redriveIdleTimeout = 5 * time.Second
+
+// DeadLetterConsumer reads the dead-letter topic once, from the last committed
+// offset up to the end of every partition, and re-drives each message. It
+// stops as soon as all claimed partitions are caught up.
+type DeadLetterConsumer struct {
+	config   config.Kafka
+	service  services.IServiceRegistry
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	pending  map[int32]bool
+	redriven int
+	err      error
+}
+
+type IDeadLetterConsumer interface {
+	Redrive(context.Context) (int, error)
+}
+
+func NewDeadLetterConsumer(kafkaConfig config.Kafka, service services.IServiceRegistry) IDeadLetterConsumer {
+	return &DeadLetterConsumer{
+		config:  kafkaConfig,
+		service: service,
+	}
+}
+
+// Redrive re-drives the dead-letter topic and returns how many messages were
+// re-driven. It uses its own consumer group, so messages that
+// were re-driven once are not re-driven again.
+func (d *DeadLetterConsumer) Redrive(ctx context.Context) (int, error) {
+	groupID := groupID(d.config) + "-redrive"
+	group, err := sarama.NewConsumerGroup(d.config.Brokers, groupID, saramaConfig(d.config))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err := group.Close()
+		if err != nil {
+			logrus.Errorf("failed to close dead-letter consumer group: %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d.cancel = cancel
+
+	logrus.Infof("re-driving dead-letter topic %s with group %s", d.config.DeadLetterTopic, groupID)
+	for ctx.Err() == nil {
+		err = group.Consume(ctx, []string{d.config.DeadLetterTopic}, d)
+		if err != nil {
+			return d.redriven, err
+		}
+	}
+
+	return d.redriven, d.err
+}
+
+func (d *DeadLetterConsumer) Setup(session sarama.ConsumerGroupSession) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pending = make(map[int32]bool)
+	for _, partition := range session.Claims()[d.config.DeadLetterTopic] {
+		d.pending[partition] = true
+	}
+	if len(d.pending) == 0 {
+		d.cancel()
+	}
+
+	return nil
+}
+
+func (d *DeadLetterConsumer) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (d *DeadLetterConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if claim.HighWaterMarkOffset() == 0 || claim.InitialOffset() >= claim.HighWaterMarkOffset() {
+		d.caughtUp(claim.Partition())
+	}
+
+	idle := time.NewTimer(redriveIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case <-idle.C:
+			d.caughtUp(claim.Partition())
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			err := d.handle(session.Context(), message)
+			if err != nil {
+				d.fail(err)
+				return err
+			}
+
+			session.MarkMessage(message, "")
+			session.Commit()
+
+			if message.Offset+1 >= claim.HighWaterMarkOffset() {
+				d.caughtUp(claim.Partition())
+			}
+			idle.Reset(redriveIdleTimeout)
+		}
+	}
+}
+
+// handle re-drives one dead letter. Malformed messages are skipped, since
+// re-driving them can never succeed.
+func (d *DeadLetterConsumer) handle(ctx context.Context, message *sarama.ConsumerMessage) error {
+	var deadLetter dto.DeadLetterMessage
+	err := json.Unmarshal(message.Value, &deadLetter)
+	if err != nil || deadLetter.Topic == "" {
+		logrus.Errorf("skipping malformed dead letter at partition %d, offset %d: %v", message.Partition, message.Offset, err)
+		return nil
+	}
+
+	err = d.service.GetOutbox().Redrive(ctx, &deadLetter)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.redriven++
+	d.mu.Unlock()
+	return nil
+}
+
+// caughtUp marks a partition as fully read and stops the redrive once every
+// claimed partition is.
+func (d *DeadLetterConsumer) caughtUp(partition int32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.pending, partition)
+	if len(d.pending) == 0 {
+		d.cancel()
+	}
+}
+
+func (d *DeadLetterConsumer) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err == nil {
+		d.err = err
+	}
+	d.cancel()
+}
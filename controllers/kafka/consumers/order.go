@@ -0,0 +1,220 @@
+package consumers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"payment-service/config"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"payment-service/services"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	minRetryBackoff    = time.Second
+	maxRetryBackoff    = time.Minute
+	defaultMaxAttempts = 10
+)
+
+// OrderConsumer consumes order events and cancels the payment of cancelled
+// orders. Offsets are committed only after a message has been handled or
+// dead-lettered, so a crash or a failing gateway call means the message is
+// consumed again.
+type OrderConsumer struct {
+	config  config.Kafka
+	service services.IServiceRegistry
+}
+
+type IOrderConsumer interface {
+	Run(context.Context)
+}
+
+func NewOrderConsumer(kafkaConfig config.Kafka, service services.IServiceRegistry) IOrderConsumer {
+	return &OrderConsumer{
+		config:  kafkaConfig,
+		service: service,
+	}
+}
+
+func groupID(kafkaConfig config.Kafka) string {
+	if kafkaConfig.ConsumerGroup != "" {
+		return kafkaConfig.ConsumerGroup
+	}
+	return constants.KafkaSender
+}
+
+// saramaConfig starts new groups at the oldest offset and leaves committing
+// offsets to the consumers, which commit only handled messages.
+func saramaConfig(kafkaConfig config.Kafka) *sarama.Config {
+	config := sarama.NewConfig()
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.Offsets.AutoCommit.Enable = false
+
+	if kafkaConfig.TimeoutInMs > 0 {
+		timeout := time.Duration(kafkaConfig.TimeoutInMs) * time.Millisecond
+		config.Net.DialTimeout = timeout
+		config.Net.ReadTimeout = timeout
+		config.Net.WriteTimeout = timeout
+	}
+
+	return config
+}
+
+// wait blocks for the given duration and reports false when ctx was cancelled
+// in the meantime.
+func wait(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+// Run consumes the order topic until ctx is cancelled, reconnecting with a
+// backoff when the brokers are unavailable.
+func (o *OrderConsumer) Run(ctx context.Context) {
+	logrus.Infof("order consumer started on topic %s with group %s", o.config.OrderTopic, groupID(o.config))
+	backoff := minRetryBackoff
+
+	for ctx.Err() == nil {
+		group, err := sarama.NewConsumerGroup(o.config.Brokers, groupID(o.config), saramaConfig(o.config))
+		if err != nil {
+			logrus.Errorf("failed to create order consumer group, retrying in %s: %v", backoff, err)
+			wait(ctx, backoff)
+			backoff = min(backoff*2, maxRetryBackoff)
+			continue
+		}
+		backoff = minRetryBackoff
+
+		for ctx.Err() == nil {
+			err = group.Consume(ctx, []string{o.config.OrderTopic}, o)
+			if err != nil {
+				logrus.Errorf("order consumer session failed: %v", err)
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) || !wait(ctx, minRetryBackoff) {
+					break
+				}
+			}
+		}
+
+		err = group.Close()
+		if err != nil {
+			logrus.Errorf("failed to close order consumer group: %v", err)
+		}
+	}
+
+	logrus.Infof("order consumer stopped")
+}
+
+func (o *OrderConsumer) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (o *OrderConsumer) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (o *OrderConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			if !o.handle(session.Context(), message) {
+				return nil
+			}
+
+			session.MarkMessage(message, "")
+			session.Commit()
+		}
+	}
+}
+
+func (o *OrderConsumer) maxAttempts() int {
+	if o.config.ConsumerMaxAttempts > 0 {
+		return o.config.ConsumerMaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+// permanent reports whether retrying a failed cancellation cannot succeed,
+// e.g. when the gateway refuses to expire a transaction that was settled
+// before its notification arrived.
+func permanent(err error) bool {
+	return errors.Is(err, errPayment.ErrGatewayRejected) ||
+		errors.Is(err, errPayment.ErrGatewayTransactionNotFound) ||
+		errors.Is(err, errPayment.ErrUnsupportedProvider)
+}
+
+// handle processes one order event and reports whether its offset may be
+// committed. Failures are retried with a backoff, up to maxAttempts times;
+// events that fail permanently or too often are dead-lettered so that they do
+// not block the partition.
+func (o *OrderConsumer) handle(ctx context.Context, message *sarama.ConsumerMessage) bool {
+	backoff := minRetryBackoff
+	for attempts := 1; ; attempts++ {
+		err := o.service.GetPayment().HandleOrderEvent(ctx, message.Value)
+		if err == nil {
+			return true
+		}
+
+		if permanent(err) || attempts >= o.maxAttempts() {
+			logrus.Errorf("failed to handle order event at partition %d, offset %d after %d attempts, dead-lettering it: %v",
+				message.Partition, message.Offset, attempts, err)
+			return o.deadLetter(ctx, message, attempts, err)
+		}
+
+		logrus.Errorf("failed to handle order event at partition %d, offset %d, retrying in %s: %v",
+			message.Partition, message.Offset, backoff, err)
+		if !wait(ctx, backoff) {
+			return false
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// deadLetter hands an event that cannot be handled to the dead-letter topic
+// and reports whether its offset may be committed. Re-driving it later hands it
+// to HandleOrderEvent again rather than republishing it to the order topic. Storing the dead letter is
+// retried until it succeeds or ctx is cancelled.
+func (o *OrderConsumer) deadLetter(ctx context.Context, message *sarama.ConsumerMessage, attempts int, cause error) bool {
+	headers := make(map[string]string, len(message.Headers))
+	for _, header := range message.Headers {
+		headers[string(header.Key)] = string(header.Value)
+	}
+
+	deadLetter := &dto.DeadLetterMessage{
+		ID:       uuid.New(),
+		Topic:    message.Topic,
+		Key:      string(message.Key),
+		Headers:  headers,
+		Payload:  json.RawMessage(message.Value),
+		Error:    cause.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	}
+
+	backoff := minRetryBackoff
+	for {
+		err := o.service.GetOutbox().DeadLetter(ctx, deadLetter)
+		if err == nil {
+			return true
+		}
+
+		logrus.Errorf("failed to dead-letter event at partition %d, offset %d, retrying in %s: %v", message.Partition, message.Offset, backoff, err)
+		if !wait(ctx, backoff) {
+			return false
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
@@ -1,58 +1,226 @@
 package kafka
 
 import (
+	"errors"
+	"net"
 	config2 "payment-service/config"
+	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/sirupsen/logrus"
 )
 
+var ErrProducerClosed = errors.New("kafka producer is closed")
+
+// unavailable are the errors of a broker that cannot take messages right now,
+// as opposed to errors of the message itself.
+var unavailable = []error{
+	sarama.ErrOutOfBrokers,
+	sarama.ErrNotConnected,
+	sarama.ErrBrokerNotAvailable,
+	sarama.ErrLeaderNotAvailable,
+	sarama.ErrNotLeaderForPartition,
+	sarama.ErrRequestTimedOut,
+	sarama.ErrNotEnoughReplicas,
+	sarama.ErrNotEnoughReplicasAfterAppend,
+	sarama.ErrNetworkException,
+}
+
+// IsUnavailable reports whether producing failed because the brokers are
+// unavailable, so that retrying the same message later can succeed.
+func IsUnavailable(err error) bool {
+	for _, target := range unavailable {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+type Message struct {
+	Topic   string
+	Key     string
+	Headers map[string]string
+	Value   []byte
+}
+
+// Kafka is a long-lived producer shared by every caller. The underlying
+// sarama producer is created on first use and re-created on the next call if
+// connecting to the brokers failed.
 type Kafka struct {
-	brokers []string
+	config    config2.Kafka
+	mutex     sync.RWMutex
+	producer  sarama.SyncProducer
+	async     sarama.AsyncProducer
+	closed    bool
+	drainDone sync.WaitGroup
 }
 
 type IKafka interface {
-	ProduceMessage(topic string, data []byte) error
+	ProduceMessage(message *Message) error
+	Close() error
 }
 
-func NewKafkaProducer(brokers []string) IKafka {
-	return &Kafka{
-		brokers: brokers,
+func NewKafkaProducer(kafkaConfig config2.Kafka) IKafka {
+	kafka := &Kafka{
+		config: kafkaConfig,
 	}
+
+	err := kafka.connect()
+	if err != nil {
+		logrus.Warnf("kafka producer not connected yet, retrying on first message: %s", err)
+	}
+
+	return kafka
 }
 
-func (k *Kafka) ProduceMessage(topic string, data []byte) error {
+func (k *Kafka) timeout() time.Duration {
+	return time.Duration(k.config.TimeoutInMs) * time.Millisecond
+}
+
+func (k *Kafka) saramaConfig() *sarama.Config {
 	config := sarama.NewConfig()
 	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
 	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Retry.Max = config2.Config.Kafka.MaxRetry
+	config.Producer.Retry.Max = k.config.MaxRetry
+
+	if timeout := k.timeout(); timeout > 0 {
+		config.Producer.Timeout = timeout
+		config.Net.DialTimeout = timeout
+		config.Net.ReadTimeout = timeout
+		config.Net.WriteTimeout = timeout
+	}
+
+	return config
+}
+
+func (k *Kafka) connect() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.closed {
+		return ErrProducerClosed
+	}
+
+	if k.producer != nil || k.async != nil {
+		return nil
+	}
+
+	if !k.config.Async {
+		producer, err := sarama.NewSyncProducer(k.config.Brokers, k.saramaConfig())
+		if err != nil {
+			logrus.Errorf("Error creating the producer: %s", err)
+			return err
+		}
+		k.producer = producer
+		return nil
+	}
 
-	producer, err := sarama.NewSyncProducer(k.brokers, config)
+	producer, err := sarama.NewAsyncProducer(k.config.Brokers, k.saramaConfig())
 	if err != nil {
 		logrus.Errorf("Error creating the producer: %s", err)
 		return err
 	}
+	k.async = producer
 
-	defer func(producer sarama.SyncProducer) {
-		err = producer.Close()
-		if err != nil {
-			logrus.Errorf("Error closing the producer: %s", err)
-			return
+	// Every message carries its own result channel in Metadata, so callers
+	// still learn whether their message was delivered while the producer
+	// batches messages of concurrent callers.
+	k.drainDone.Add(2)
+	go func() {
+		defer k.drainDone.Done()
+		for message := range producer.Successes() {
+			logrus.Infof("Message sent to topic %s at partition %d, offset %d", message.Topic, message.Partition, message.Offset)
+			message.Metadata.(chan error) <- nil
+		}
+	}()
+	go func() {
+		defer k.drainDone.Done()
+		for producerError := range producer.Errors() {
+			logrus.Errorf("Error sending message to topic %s: %s", producerError.Msg.Topic, producerError.Err)
+			producerError.Msg.Metadata.(chan error) <- producerError.Err
 		}
-	}(producer)
+	}()
+
+	return nil
+}
 
+func (k *Kafka) ProduceMessage(request *Message) error {
+	err := k.connect()
+	if err != nil {
+		return err
+	}
+
+	topic := request.Topic
+	headers := make([]sarama.RecordHeader, 0, len(request.Headers))
+	for key, value := range request.Headers {
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(key),
+			Value: []byte(value),
+		})
+	}
+
+	// Messages are keyed so that the default hash partitioner sends every
+	// event of the same order to the same partition, preserving their order.
 	message := &sarama.ProducerMessage{
 		Topic:   topic,
-		Headers: nil,
-		Value:   sarama.ByteEncoder(data),
+		Headers: headers,
+		Value:   sarama.ByteEncoder(request.Value),
+	}
+	if request.Key != "" {
+		message.Key = sarama.StringEncoder(request.Key)
 	}
 
-	partition, offset, err := producer.SendMessage(message)
-	if err != nil {
-		logrus.Errorf("Error sending message to topic %s: %s", topic, err)
-		return err
+	k.mutex.RLock()
+	if k.closed {
+		k.mutex.RUnlock()
+		return ErrProducerClosed
+	}
+
+	if k.producer != nil {
+		defer k.mutex.RUnlock()
+		partition, offset, err := k.producer.SendMessage(message)
+		if err != nil {
+			logrus.Errorf("Error sending message to topic %s: %s", topic, err)
+			return err
+		}
+
+		logrus.Infof("Message sent to topic %s at partition %d, offset %d", topic, partition, offset)
+		return nil
+	}
+
+	result := make(chan error, 1)
+	message.Metadata = result
+	k.async.Input() <- message
+	k.mutex.RUnlock()
+
+	return <-result
+}
+
+// Close flushes buffered messages and closes the connections to the brokers.
+func (k *Kafka) Close() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.closed {
+		return nil
+	}
+	k.closed = true
+
+	if k.producer != nil {
+		return k.producer.Close()
+	}
+
+	if k.async != nil {
+		// AsyncClose flushes the buffered messages, then closes the success
+		// and error channels which ends the drain goroutines.
+		k.async.AsyncClose()
+		k.drainDone.Wait()
 	}
 
-	logrus.Infof("Message sent to topic %s at partition %d, offset %d", topic, partition, offset)
 	return nil
 }
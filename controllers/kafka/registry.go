@@ -1,19 +1,26 @@
 package kafka
 
+import config2 "payment-service/config"
+
 type Registry struct {
-	brokers []string
+	producer IKafka
 }
 
 type IKafkaRegistry interface {
 	GetKafkaProducer() IKafka
+	Close() error
 }
 
-func NewKafkaRegistry(brokers []string) IKafkaRegistry {
+func NewKafkaRegistry(kafkaConfig config2.Kafka) IKafkaRegistry {
 	return &Registry{
-		brokers: brokers,
+		producer: NewKafkaProducer(kafkaConfig),
 	}
 }
 
 func (r *Registry) GetKafkaProducer() IKafka {
-	return NewKafkaProducer(r.brokers)
+	return r.producer
+}
+
+func (r *Registry) Close() error {
+	return r.producer.Close()
 }
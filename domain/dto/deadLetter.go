@@ -0,0 +1,30 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeadLetterMessage is an outbox message that could not be published, or a
+// consumed event that could not be handled, after the maximum number of
+// attempts. It is published to the dead-letter topic, or stored in the
+// dead_letters table when Kafka is unavailable. OutboxID is zero for consumed
+// events, whose Topic is the topic they were consumed from; they are re-driven
+// into the handler of that topic, never republished to it.
+type DeadLetterMessage struct {
+	ID       uuid.UUID         `json:"id"`
+	OutboxID uint              `json:"outbox_id"`
+	Topic    string            `json:"topic"`
+	Key      string            `json:"key"`
+	Headers  map[string]string `json:"headers"`
+	Payload  json.RawMessage   `json:"payload"`
+	Error    string            `json:"error"`
+	Attempts int               `json:"attempts"`
+	FailedAt time.Time         `json:"failed_at"`
+}
+
+type DeadLetterRequestParam struct {
+	UUID *string `json:"uuid"`
+}
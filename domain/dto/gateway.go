@@ -0,0 +1,69 @@
+package dto
+
+import (
+	"payment-service/constants"
+
+	"github.com/google/uuid"
+)
+
+type PaymentLinkResponse struct {
+	Token       string `json:"token"`
+	RedirectURL string `json:"redirect_url"`
+}
+
+// PaymentNotification is a payment notification or status of any gateway,
+// already verified and translated by the gateway of its provider.
+type PaymentNotification struct {
+	Provider          constants.PaymentProvider     `json:"provider"`
+	OrderID           uuid.UUID                     `json:"order_id"`
+	TransactionID     string                        `json:"transaction_id"`
+	TransactionStatus constants.PaymentStatusString `json:"transaction_status"`
+	FraudStatus       constants.FraudStatus         `json:"fraud_status"`
+	Paid              bool                          `json:"paid"`
+	PaymentMethod     string                        `json:"payment_method"`
+	VANumber          string                        `json:"va_number"`
+	Bank              string                        `json:"bank"`
+	Acquirer          *string                       `json:"acquirer"`
+	GrossAmount       string                        `json:"gross_amount"`
+	Currency          string                        `json:"currency"`
+	Refund            *GatewayRefund                `json:"refund"`
+	RawPayload        []byte                        `json:"-"`
+}
+
+// GatewayRefund is the latest refund of a refunded transaction.
+type GatewayRefund struct {
+	RefundKey string `json:"refund_key"`
+	Amount    int64  `json:"amount"`
+	Reason    string `json:"reason"`
+}
+
+type GatewayRefundRequest struct {
+	RefundKey string `json:"refund_key"`
+	Amount    int64  `json:"amount"`
+	Reason    string `json:"reason"`
+}
+
+type SimulateNotificationRequest struct {
+	OrderID           uuid.UUID                     `json:"order_id"`
+	Amount            int64                         `json:"amount"`
+	TransactionStatus constants.PaymentStatusString `json:"transaction_status"`
+	PaymentType       string                        `json:"payment_type"`
+	Bank              string                        `json:"bank"`
+}
+
+type SimulatePaymentRequest struct {
+	Status      constants.PaymentStatusString `form:"status" validate:"required"`
+	PaymentType string                        `form:"payment_type"`
+}
+
+// ChargeResponse holds what the customer needs to pay a direct charge: a
+// virtual account or bill key, a QR string or an e-wallet deeplink.
+type ChargeResponse struct {
+	TransactionID string  `json:"transaction_id"`
+	PaymentMethod string  `json:"payment_method"`
+	VANumber      *string `json:"va_number"`
+	Bank          *string `json:"bank"`
+	BillerCode    *string `json:"biller_code"`
+	QRString      *string `json:"qr_string"`
+	Deeplink      *string `json:"deeplink"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+type IdempotencyKeyRequest struct {
+	Scope       string `json:"scope"`
+	Owner       string `json:"owner"`
+	Key         string `json:"key"`
+	RequestHash string `json:"request_hash"`
+}
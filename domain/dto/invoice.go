@@ -9,6 +9,7 @@ type InvoiceData struct {
 	PaymentDetail InvoicePaymentDetail `json:"paymentDetail"`
 	Items         []InvoiceItem        `json:"items"`
 	Total         string               `json:"total"`
+	IsCreditNote  bool                 `json:"isCreditNote"`
 }
 
 type InvoicePaymentDetail struct {
@@ -2,6 +2,7 @@ package dto
 
 import (
 	"github.com/google/uuid"
+	"payment-service/common/money"
 	"time"
 )
 
@@ -32,3 +33,53 @@ type KafkaMessage struct {
 	MetaData KafkaMetaData `json:"meta_data"`
 	Body     KafkaBody     `json:"body"`
 }
+
+// PaymentEvent is the v2 payment event: a CloudEvents 1.0 envelope in
+// structured mode whose data is a full payment snapshot.
+type PaymentEvent struct {
+	SpecVersion     string           `json:"specversion"`
+	ID              uuid.UUID        `json:"id"`
+	Source          string           `json:"source"`
+	Type            string           `json:"type"`
+	Subject         string           `json:"subject"`
+	Time            time.Time        `json:"time"`
+	DataContentType string           `json:"datacontenttype"`
+	DataSchema      string           `json:"dataschema"`
+	CorrelationID   string           `json:"correlationid"`
+	Data            PaymentEventData `json:"data"`
+}
+
+type PaymentEventData struct {
+	Event     string    `json:"event"`
+	OrderID   uuid.UUID `json:"order_id"`
+	PaymentID uuid.UUID `json:"payment_id"`
+	Status    string    `json:"status"`
+	money.Money
+	PaymentMethod *string    `json:"payment_method"`
+	Bank          *string    `json:"bank"`
+	VANumber      *string    `json:"va_number"`
+	InvoiceLink   *string    `json:"invoice_link"`
+	TransactionID *string    `json:"transaction_id"`
+	Description   *string    `json:"description"`
+	PaidAt        *time.Time `json:"paid_at"`
+	ExpiredAt     *time.Time `json:"expired_at"`
+	CreatedAt     *time.Time `json:"created_at"`
+	UpdatedAt     *time.Time `json:"updated_at"`
+}
+
+type OrderEventData struct {
+	OrderID uuid.UUID `json:"order_id"`
+}
+
+type OrderEventBody struct {
+	Type string          `json:"type"`
+	Data *OrderEventData `json:"data"`
+}
+
+// OrderEvent is the event published by the order service, which follows the
+// same envelope as the v1 payment event.
+type OrderEvent struct {
+	Event    KafkaEvent     `json:"event"`
+	MetaData KafkaMetaData  `json:"meta_data"`
+	Body     OrderEventBody `json:"body"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+type OutboxRequest struct {
+	Topic   string            `json:"topic"`
+	Key     string            `json:"key"`
+	Headers map[string]string `json:"headers"`
+	Payload []byte            `json:"payload"`
+}
@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"payment-service/common/money"
 	"payment-service/constants"
 	"time"
 
@@ -8,33 +9,98 @@ import (
 )
 
 type PaymentRequest struct {
-	PaymentLink    string          `json:"payment_link"`
-	OrderID        string          `json:"orderId"`
-	ExpiredAt      time.Time       `json:"expiredAt"`
-	Amount         float64         `json:"amount"`
-	Description    *string         `json:"description"`
-	CustomerDetail *CustomerDetail `json:"customerDetail"`
-	ItemDetail     []ItemDetail    `json:"itemDetails"`
+	PaymentLink string    `json:"payment_link"`
+	OrderID     string    `json:"orderId"`
+	ExpiredAt   time.Time `json:"expiredAt"`
+	money.Money
+	Description    *string                   `json:"description"`
+	CustomerDetail *CustomerDetail           `json:"customerDetail"`
+	ItemDetail     []ItemDetail              `json:"itemDetails"`
+	Provider       constants.PaymentProvider `json:"provider"`
+	CustomerID     *uuid.UUID                `json:"-"`
+	IdempotencyKey string                    `json:"-"`
+}
+
+type ChargeRequest struct {
+	PaymentRequest
+	PaymentMethod constants.ChargeMethod `json:"paymentMethod" validate:"required"`
 }
 
 type CustomerDetail struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Phone string `json:"phone"`
+	Name            string   `json:"name"`
+	LastName        string   `json:"lastName"`
+	Email           string   `json:"email"`
+	Phone           string   `json:"phone"`
+	BillingAddress  *Address `json:"billingAddress"`
+	ShippingAddress *Address `json:"shippingAddress"`
+}
+
+type Address struct {
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
+	Phone       string `json:"phone"`
+	Address     string `json:"address"`
+	City        string `json:"city"`
+	PostalCode  string `json:"postalCode"`
+	CountryCode string `json:"countryCode"`
 }
 
 type ItemDetail struct {
-	ID       string  `json:"id"`
-	Amount   float64 `json:"amount"`
-	Name     string  `json:"name"`
-	Quantity int     `json:"quantity"`
+	ID       string `json:"id"`
+	Amount   int64  `json:"amount"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
 }
 
+// PaymentRequestParam pages through payments. Every filter is optional;
+// status may be repeated or comma-separated, ranges are inclusive and
+// search matches words of the description. Sort is a comma-separated list of
+// fields, each prefixed with - to sort descending, e.g. "-paid_at,amount";
+// sort_column and sort_order are still accepted for a single field.
+//
+// With page, the total is counted unless with_count is false; counting a large
+// filtered set is slow, so clients that only follow nextPage can skip it.
+// With cursor instead of page, payments are paged by cursor: newest first,
+// starting after cursor, the nextCursor of the previous page, or from the
+// newest payment when cursor is empty. The total is then only counted when
+// with_count is true.
 type PaymentRequestParam struct {
-	Page       int     `form:"page" validate:"required"`
-	Limit      int     `form:"limit" validate:"required"`
-	SortColumn *string `form:"sort_column" validate:"required"`
-	SortOrder  *string `form:"sort_order" validate:"required"`
+	Page          int                             `form:"page" validate:"required_without=Cursor,excluded_with=Cursor,gte=0"`
+	Limit         int                             `form:"limit" validate:"required,min=1,max=100"`
+	Cursor        *string                         `form:"cursor"`
+	WithCount     *bool                           `form:"with_count"`
+	After         *PaymentCursor                  `form:"-"`
+	Sort          *string                         `form:"sort" validate:"omitempty,max=255"`
+	SortColumn    *string                         `form:"sort_column"`
+	SortOrder     *string                         `form:"sort_order" validate:"omitempty,oneof=asc desc ASC DESC"`
+	SortFields    []SortField                     `form:"-"`
+	Statuses      []constants.PaymentStatusString `form:"status"`
+	OrderID       *string                         `form:"order_id" validate:"omitempty,uuid"`
+	TransactionID *string                         `form:"transaction_id"`
+	Bank          *string                         `form:"bank"`
+	PaymentMethod *string                         `form:"payment_method"`
+	MinAmount     *int64                          `form:"min_amount" validate:"omitempty,gte=0"`
+	MaxAmount     *int64                          `form:"max_amount" validate:"omitempty,gte=0"`
+	CreatedFrom   *time.Time                      `form:"created_from"`
+	CreatedTo     *time.Time                      `form:"created_to"`
+	PaidFrom      *time.Time                      `form:"paid_from"`
+	PaidTo        *time.Time                      `form:"paid_to"`
+	ExpiredFrom   *time.Time                      `form:"expired_from"`
+	ExpiredTo     *time.Time                      `form:"expired_to"`
+	Search        *string                         `form:"search" validate:"omitempty,max=255"`
+}
+
+// PaymentCursor is the last payment of a page, encoded into the opaque cursor
+// of the next one.
+type PaymentCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        uint      `json:"id"`
+}
+
+// SortField is a whitelisted column to order by.
+type SortField struct {
+	Column string
+	Desc   bool
 }
 
 type UpdatePaymentRequest struct {
@@ -45,13 +111,19 @@ type UpdatePaymentRequest struct {
 	Bank          *string                  `form:"bank"`
 	InvoiceLink   *string                  `form:"invoice_link,omitempty"`
 	Acquirer      *string                  `form:"acquirer"`
+	PaymentMethod *string                  `form:"payment_method"`
+	BillerCode    *string                  `form:"biller_code"`
+	QRString      *string                  `form:"qr_string"`
+	Deeplink      *string                  `form:"deeplink"`
 }
 
 type PaymentResponse struct {
-	UUID          uuid.UUID                     `json:"uuid"`
-	OrderID       uuid.UUID                     `json:"order_id"`
-	Amount        float64                       `json:"amount"`
+	UUID    uuid.UUID `json:"uuid"`
+	OrderID uuid.UUID `json:"order_id"`
+	money.Money
 	Status        constants.PaymentStatusString `json:"status"`
+	Provider      constants.PaymentProvider     `json:"provider"`
+	CustomerID    *uuid.UUID                    `json:"customer_id,omitempty"`
 	PaymentLink   string                        `json:"payment_link"`
 	InvoiceLink   *string                       `json:"invoice_link"`
 	TransactionID *string                       `form:"transaction_id,omitempty"`
@@ -59,37 +131,19 @@ type PaymentResponse struct {
 	VANumber      *string                       `form:"va_number,omitempty"`
 	Bank          *string                       `form:"bank,omitempty"`
 	Acquirer      *string                       `form:"acquirer,omitempty"`
+	PaymentMethod *string                       `json:"payment_method,omitempty"`
+	BillerCode    *string                       `json:"biller_code,omitempty"`
+	QRString      *string                       `json:"qr_string,omitempty"`
+	Deeplink      *string                       `json:"deeplink,omitempty"`
 	Description   *string                       `form:"description"`
 	ExpiredAt     *time.Time                    `json:"expired_at"`
 	CreatedAt     *time.Time                    `json:"created_at"`
 	UpdatedAt     *time.Time                    `json:"updated_at"`
 }
 
-type WebHook struct {
-	VANumbers         []VANumber                    `json:"va_numbers"`
-	TransactionTime   string                        `json:"transaction_time"`
-	TransactionStatus constants.PaymentStatusString `json:"transaction_status"`
-	TransactionID     string                        `json:"transaction_id"`
-	StatusMessage     string                        `json:"status_message"`
-	StatusCode        string                        `json:"status_code"`
-	SignatureKey      string                        `json:"signature_key"`
-	SettlementTime    string                        `json:"settlement_time"`
-	PaymentType       string                        `json:"payment_type"`
-	PaymentAmount     []PaymentAmount               `json:"payment_amount"`
-	OrderID           uuid.UUID                     `json:"order_id"`
-	MerchantID        string                        `json:"merchant_id"`
-	GrossAmount       string                        `json:"gross_amount"`
-	FraudStatus       string                        `json:"fraud_status"`
-	Currency          string                        `json:"currency"`
-	Acquirer          *string                       `json:"acquirer"`
-}
-
-type VANumber struct {
-	VaNumber string `json:"va_number"`
-	Bank     string `json:"bank"`
-}
-
-type PaymentAmount struct {
-	PaidAt *string `json:"paid_at"`
-	Amount *string `json:"amount"`
+type ExpiryRequestParam struct {
+	Statuses      []constants.PaymentStatus `json:"statuses"`
+	ExpiredBefore time.Time                 `json:"expired_before"`
+	AfterID       uint                      `json:"after_id"`
+	Limit         int                       `json:"limit"`
 }
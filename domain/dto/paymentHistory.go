@@ -5,4 +5,5 @@ import "payment-service/constants"
 type PaymentHistoryRequest struct {
 	PaymentID uint                          `json:"payment_id"`
 	Status    constants.PaymentStatusString `json:"status"`
+	Note      *string                       `json:"note"`
 }
@@ -0,0 +1,38 @@
+package dto
+
+import (
+	"payment-service/constants"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReconcileRequestParam struct {
+	Statuses      []constants.PaymentStatus `json:"statuses"`
+	CreatedAfter  time.Time                 `json:"created_after"`
+	UpdatedBefore time.Time                 `json:"updated_before"`
+	AfterID       uint                      `json:"after_id"`
+	Limit         int                       `json:"limit"`
+}
+
+// ReconcileReport summarises a reconciliation run. Mismatches lists every
+// payment whose local status differed from the gateway status.
+type ReconcileReport struct {
+	Checked    int                 `json:"checked"`
+	InSync     int                 `json:"in_sync"`
+	Fixed      int                 `json:"fixed"`
+	NotFound   int                 `json:"not_found"`
+	Conflicts  int                 `json:"conflicts"`
+	Failed     int                 `json:"failed"`
+	Mismatches []ReconcileMismatch `json:"mismatches"`
+}
+
+type ReconcileMismatch struct {
+	PaymentID     uuid.UUID                     `json:"payment_id"`
+	OrderID       uuid.UUID                     `json:"order_id"`
+	Provider      constants.PaymentProvider     `json:"provider"`
+	LocalStatus   constants.PaymentStatusString `json:"local_status"`
+	GatewayStatus constants.PaymentStatusString `json:"gateway_status"`
+	Result        constants.ReconcileResult     `json:"result"`
+	Error         string                        `json:"error,omitempty"`
+}
@@ -0,0 +1,46 @@
+package dto
+
+import (
+	"payment-service/common/money"
+	"payment-service/constants"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateRefundRequest refunds Amount of a paid payment, or everything that
+// has not been refunded yet when Amount is omitted. Retrying with the same
+// IdempotencyKey resumes or replays the same refund.
+type CreateRefundRequest struct {
+	Amount         *int64 `json:"amount" validate:"omitempty,gt=0"`
+	Reason         string `json:"reason" validate:"required,max=255"`
+	IdempotencyKey string `json:"-"`
+}
+
+type RefundRequest struct {
+	UUID      uuid.UUID `json:"uuid"`
+	PaymentID uint      `json:"payment_id"`
+	RefundKey string    `json:"refund_key"`
+	money.Money
+	Reason         string                 `json:"reason"`
+	Status         constants.RefundStatus `json:"status"`
+	CreditNoteLink *string                `json:"credit_note_link"`
+}
+
+type UpdateRefundRequest struct {
+	Status         *constants.RefundStatus `json:"status"`
+	CreditNoteLink *string                 `json:"credit_note_link"`
+}
+
+type RefundResponse struct {
+	UUID      uuid.UUID `json:"uuid"`
+	PaymentID uuid.UUID `json:"payment_id"`
+	OrderID   uuid.UUID `json:"order_id"`
+	money.Money
+	RefundedAmount int64                         `json:"refunded_amount"`
+	Reason         string                        `json:"reason"`
+	Status         constants.RefundStatus        `json:"status"`
+	PaymentStatus  constants.PaymentStatusString `json:"payment_status"`
+	CreditNoteLink *string                       `json:"credit_note_link"`
+	CreatedAt      *time.Time                    `json:"created_at"`
+}
@@ -0,0 +1,40 @@
+package dto
+
+import (
+	"payment-service/constants"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookEventRequest struct {
+	Provider          constants.PaymentProvider     `json:"provider"`
+	OrderID           uuid.UUID                     `json:"order_id"`
+	TransactionID     string                        `json:"transaction_id"`
+	TransactionStatus constants.PaymentStatusString `json:"transaction_status"`
+	NotificationKey   string                        `json:"notification_key"`
+	Payload           []byte                        `json:"payload"`
+}
+
+type UpdateWebhookEventRequest struct {
+	Status constants.WebhookEventStatus `json:"status"`
+	Error  *string                      `json:"error"`
+}
+
+type WebhookEventRequestParam struct {
+	OrderID  *uuid.UUID                     `json:"order_id"`
+	Since    *time.Time                     `json:"since"`
+	Statuses []constants.WebhookEventStatus `json:"statuses"`
+}
+
+type WebhookEventResponse struct {
+	UUID              uuid.UUID                     `json:"uuid"`
+	Provider          constants.PaymentProvider     `json:"provider"`
+	OrderID           uuid.UUID                     `json:"order_id"`
+	TransactionID     string                        `json:"transaction_id"`
+	TransactionStatus constants.PaymentStatusString `json:"transaction_status"`
+	Status            constants.WebhookEventStatus  `json:"status"`
+	Error             *string                       `json:"error"`
+	ProcessedAt       *time.Time                    `json:"processed_at"`
+	CreatedAt         *time.Time                    `json:"created_at"`
+}
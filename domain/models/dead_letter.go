@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DeadLetter struct {
+	ID          uint              `gorm:"primaryKey;autoIncrement"`
+	UUID        uuid.UUID         `gorm:"type:uuid;not null"`
+	OutboxID    uint              `gorm:"type:bigint;not null"`
+	Topic       string            `gorm:"type:varchar(255);not null"`
+	Key         string            `gorm:"type:varchar(255);not null;default:''"`
+	Headers     map[string]string `gorm:"type:jsonb;serializer:json"`
+	Payload     string            `gorm:"type:jsonb;not null"`
+	Error       string            `gorm:"type:text;not null"`
+	Attempts    int               `gorm:"not null"`
+	RedrivenAt  *time.Time
+	DiscardedAt *time.Time
+	CreatedAt   *time.Time
+	UpdatedAt   *time.Time
+}
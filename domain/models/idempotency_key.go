@@ -0,0 +1,27 @@
+package models
+
+import (
+	"payment-service/constants"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey is unique per scope and owner, the user who sent the
+// request, so that one caller cannot replay or block the requests of another.
+// Lease identifies the request holding the key, so that a request whose lease
+// was taken over can no longer complete or release it.
+type IdempotencyKey struct {
+	ID          uint                           `gorm:"primaryKey;autoIncrement"`
+	Scope       string                         `gorm:"type:varchar(100);not null;uniqueIndex:idx_idempotency_keys_scope_owner_key"`
+	Owner       string                         `gorm:"type:varchar(100);not null;default:'';uniqueIndex:idx_idempotency_keys_scope_owner_key"`
+	Key         string                         `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_keys_scope_owner_key"`
+	RequestHash string                         `gorm:"type:varchar(64);not null"`
+	Status      constants.IdempotencyKeyStatus `gorm:"type:varchar(50);not null"`
+	Response    *string                        `gorm:"type:jsonb;default:null"`
+	Lease       uuid.UUID                      `gorm:"type:uuid;not null"`
+	LockedUntil *time.Time
+	ExpiresAt   *time.Time `gorm:"index"`
+	CreatedAt   *time.Time
+	UpdatedAt   *time.Time
+}
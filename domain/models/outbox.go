@@ -0,0 +1,29 @@
+package models
+
+import (
+	"payment-service/constants"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Outbox struct {
+	ID            uint                   `gorm:"primaryKey;autoIncrement"`
+	UUID          uuid.UUID              `gorm:"type:uuid;not null"`
+	Topic         string                 `gorm:"type:varchar(255);not null"`
+	Key           string                 `gorm:"type:varchar(255);not null;default:'';index"`
+	Headers       map[string]string      `gorm:"type:jsonb;serializer:json"`
+	Payload       string                 `gorm:"type:jsonb;not null"`
+	Status        constants.OutboxStatus `gorm:"type:varchar(50);not null;index:idx_outbox_status_next_attempt_at"`
+	Attempts      int                    `gorm:"not null;default:0"`
+	LastError     *string                `gorm:"type:text;default:null"`
+	NextAttemptAt *time.Time             `gorm:"index:idx_outbox_status_next_attempt_at"`
+	ClaimID       *uuid.UUID             `gorm:"type:uuid"`
+	SentAt        *time.Time
+	CreatedAt     *time.Time
+	UpdatedAt     *time.Time
+}
+
+func (Outbox) TableName() string {
+	return "outbox"
+}
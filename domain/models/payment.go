@@ -1,6 +1,7 @@
 package models
 
 import (
+	"payment-service/common/money"
 	"payment-service/constants"
 	"time"
 
@@ -8,21 +9,28 @@ import (
 )
 
 type Payment struct {
-	ID               uint                     `gorm:"primaryKey;autoIncrement"`
-	UUID             uuid.UUID                `gorm:"type:uuid;not null"`
-	OrderID          uuid.UUID                `gorm:"type:uuid;not null"`
-	Amount           float64                  `gorm:"not null"`
-	Status           *constants.PaymentStatus `gorm:"not null"`
-	PaymentLink      string                   `gorm:"type:varchar(255);not null"`
-	InvoiceLink      *string                  `gorm:"type:varchar(255);default:null"`
-	VANumber         *string                  `gorm:"type:varchar(255);default:null"`
-	Bank             *string                  `gorm:"type:varchar(255);default:null"`
-	Acquirer         *string                  `gorm:"type:varchar(255);default:null"`
-	TransactionID    *string                  `gorm:"type:varchar(255);default:null"`
-	Description      *string                  `gorm:"type:text;default:null"`
-	PaidAt           *time.Time
-	ExpiredAt        *time.Time
-	CreatedAt        *time.Time
+	ID      uint      `gorm:"primaryKey;autoIncrement;index:idx_payments_created_at_id,priority:2"`
+	UUID    uuid.UUID `gorm:"type:uuid;not null"`
+	OrderID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex"`
+	money.Money
+	Status           *constants.PaymentStatus  `gorm:"not null;index:idx_payments_status_expired_at"`
+	Provider         constants.PaymentProvider `gorm:"type:varchar(50);not null;default:'midtrans'"`
+	CustomerID       *uuid.UUID                `gorm:"type:uuid;default:null;index"`
+	PaymentLink      string                    `gorm:"type:varchar(255);not null"`
+	InvoiceLink      *string                   `gorm:"type:varchar(255);default:null"`
+	VANumber         *string                   `gorm:"type:varchar(255);default:null"`
+	Bank             *string                   `gorm:"type:varchar(255);default:null;index:idx_payments_payment_method_bank,priority:2"`
+	Acquirer         *string                   `gorm:"type:varchar(255);default:null"`
+	PaymentMethod    *string                   `gorm:"type:varchar(50);default:null;index:idx_payments_payment_method_bank,priority:1"`
+	BillerCode       *string                   `gorm:"type:varchar(50);default:null"`
+	QRString         *string                   `gorm:"type:text;default:null"`
+	Deeplink         *string                   `gorm:"type:text;default:null"`
+	TransactionID    *string                   `gorm:"type:varchar(255);default:null;index"`
+	Description      *string                   `gorm:"type:text;default:null"`
+	PaidAt           *time.Time                `gorm:"index"`
+	ExpiredAt        *time.Time                `gorm:"index:idx_payments_status_expired_at"`
+	CreatedAt        *time.Time                `gorm:"index:idx_payments_created_at_id,priority:1"`
 	UpdatedAt        *time.Time
 	PaymentHistories []PaymentHistory `gorm:"foreignKey:payment_id;references:id;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Refunds          []Refund         `gorm:"foreignKey:payment_id;references:id;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 }
@@ -9,6 +9,7 @@ type PaymentHistory struct {
 	ID        uint                          `gorm:"primaryKey;autoIncrement"`
 	PaymentID uint                          `gorm:"type:bigint;not null"`
 	Status    constants.PaymentStatusString `gorm:"type:varchar(50);not null"`
+	Note      *string                       `gorm:"type:text;default:null"`
 	CreatedAt *time.Time
 	UpdatedAt *time.Time
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"payment-service/common/money"
+	"payment-service/constants"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Refund struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UUID      uuid.UUID `gorm:"type:uuid;not null"`
+	PaymentID uint      `gorm:"type:bigint;not null;index"`
+	RefundKey string    `gorm:"type:varchar(255);not null;uniqueIndex"`
+	money.Money
+	Reason         string                 `gorm:"type:text;not null"`
+	Status         constants.RefundStatus `gorm:"type:varchar(50);not null"`
+	CreditNoteLink *string                `gorm:"type:varchar(255);default:null"`
+	CreatedAt      *time.Time
+	UpdatedAt      *time.Time
+}
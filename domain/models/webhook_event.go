@@ -0,0 +1,24 @@
+package models
+
+import (
+	"payment-service/constants"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookEvent struct {
+	ID                uint                          `gorm:"primaryKey;autoIncrement"`
+	UUID              uuid.UUID                     `gorm:"type:uuid;not null"`
+	Provider          constants.PaymentProvider     `gorm:"type:varchar(50);not null;default:'midtrans'"`
+	OrderID           uuid.UUID                     `gorm:"type:uuid;not null;index"`
+	TransactionID     string                        `gorm:"type:varchar(255);not null"`
+	TransactionStatus constants.PaymentStatusString `gorm:"type:varchar(50);not null"`
+	NotificationKey   *string                       `gorm:"type:varchar(64);default:null;uniqueIndex"`
+	Payload           string                        `gorm:"type:jsonb;not null"`
+	Status            constants.WebhookEventStatus  `gorm:"type:varchar(50);not null"`
+	Error             *string                       `gorm:"type:text;default:null"`
+	ProcessedAt       *time.Time
+	CreatedAt         *time.Time
+	UpdatedAt         *time.Time
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/didip/tollbooth"
 	"github.com/didip/tollbooth/limiter"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
@@ -36,6 +37,22 @@ func HandlePanic() gin.HandlerFunc {
 	}
 }
 
+// RequestID propagates the caller's request ID, or generates one, so it can be
+// used as correlation ID in logs and Kafka events.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(constants.XRequestID)
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+
+		ctx := context.WithValue(c.Request.Context(), constants.RequestID, requestID)
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer.Header().Set(constants.XRequestID, requestID)
+		c.Next()
+	}
+}
+
 func RateLimiter(lmt *limiter.Limiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		err := tollbooth.LimitByRequest(lmt, c.Writer, c.Request)
@@ -125,6 +142,8 @@ func CheckRole(roles []string, client clients.IClientRegistry) gin.HandlerFunc {
 		}
 
 		logrus.Infof("✅ [CheckRole] Access granted for role: %s", user.Role)
+		ctx := context.WithValue(c.Request.Context(), constants.User, user)
+		c.Request = c.Request.WithContext(ctx)
 		c.Next()
 	}
 }
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+	error2 "payment-service/common/error"
+	errConstant "payment-service/constants/error"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DeadLetterRepository struct {
+	db *gorm.DB
+}
+
+type IDeadLetterRepository interface {
+	Create(context.Context, *gorm.DB, *dto.DeadLetterMessage) error
+	FindNotRedriven(context.Context, *dto.DeadLetterRequestParam) ([]models.DeadLetter, error)
+	MarkRedriven(context.Context, *gorm.DB, uint) error
+	MarkDiscarded(context.Context, *gorm.DB, uint) error
+}
+
+func NewDeadLetterRepository(db *gorm.DB) IDeadLetterRepository {
+	return &DeadLetterRepository{db: db}
+}
+
+func (d *DeadLetterRepository) Create(ctx context.Context, tx *gorm.DB, req *dto.DeadLetterMessage) error {
+	deadLetter := models.DeadLetter{
+		UUID:     req.ID,
+		OutboxID: req.OutboxID,
+		Topic:    req.Topic,
+		Key:      req.Key,
+		Headers:  req.Headers,
+		Payload:  string(req.Payload),
+		Error:    req.Error,
+		Attempts: req.Attempts,
+	}
+
+	err := tx.WithContext(ctx).Create(&deadLetter).Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
+
+func (d *DeadLetterRepository) FindNotRedriven(ctx context.Context, param *dto.DeadLetterRequestParam) ([]models.DeadLetter, error) {
+	var deadLetters []models.DeadLetter
+	query := d.db.WithContext(ctx).Where("redriven_at IS NULL AND discarded_at IS NULL")
+	if param.UUID != nil {
+		query = query.Where("uuid = ?", *param.UUID)
+	}
+
+	err := query.Order("id asc").Find(&deadLetters).Error
+	if err != nil {
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return deadLetters, nil
+}
+
+func (d *DeadLetterRepository) MarkRedriven(ctx context.Context, tx *gorm.DB, id uint) error {
+	err := tx.WithContext(ctx).
+		Model(&models.DeadLetter{}).
+		Where("id = ?", id).
+		Update("redriven_at", time.Now()).
+		Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
+
+// MarkDiscarded marks the stored dead letters of a discarded outbox message,
+// so that they are not re-driven.
+func (d *DeadLetterRepository) MarkDiscarded(ctx context.Context, tx *gorm.DB, outboxID uint) error {
+	err := tx.WithContext(ctx).
+		Model(&models.DeadLetter{}).
+		Where("outbox_id = ? AND redriven_at IS NULL AND discarded_at IS NULL", outboxID).
+		Update("discarded_at", time.Now()).
+		Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
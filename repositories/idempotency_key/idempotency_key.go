@@ -0,0 +1,139 @@
+package repositories
+
+import (
+	"context"
+	error2 "payment-service/common/error"
+	"payment-service/constants"
+	errConstant "payment-service/constants/error"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyKeyRepository struct {
+	db *gorm.DB
+}
+
+type IIdempotencyKeyRepository interface {
+	Create(context.Context, *gorm.DB, *dto.IdempotencyKeyRequest) (*models.IdempotencyKey, bool, error)
+	Complete(context.Context, *gorm.DB, *models.IdempotencyKey, []byte) (bool, error)
+	Delete(context.Context, *gorm.DB, *models.IdempotencyKey) error
+	DeleteExpired(context.Context, time.Time, int) (int, error)
+}
+
+func NewIdempotencyKeyRepository(db *gorm.DB) IIdempotencyKeyRepository {
+	return &IdempotencyKeyRepository{db: db}
+}
+
+// Create claims the idempotency key of the owner for IdempotencyKeyLease. It
+// reports false, with the stored key, when the key was already claimed by an
+// earlier request, unless that request left it processing past its lease and
+// this is the same request, which then takes the key over. A key past its
+// IdempotencyKeyTTL is taken over by any request.
+func (i *IdempotencyKeyRepository) Create(ctx context.Context, tx *gorm.DB, req *dto.IdempotencyKeyRequest) (*models.IdempotencyKey, bool, error) {
+	now := time.Now()
+	lockedUntil := now.Add(constants.IdempotencyKeyLease)
+	expiresAt := now.Add(constants.IdempotencyKeyTTL)
+	key := models.IdempotencyKey{
+		Scope:       req.Scope,
+		Owner:       req.Owner,
+		Key:         req.Key,
+		RequestHash: req.RequestHash,
+		Status:      constants.IdempotencyKeyProcessing,
+		Lease:       uuid.New(),
+		LockedUntil: &lockedUntil,
+		ExpiresAt:   &expiresAt,
+	}
+
+	result := tx.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&key)
+	if result.Error != nil {
+		return nil, false, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	if result.RowsAffected > 0 {
+		return &key, true, nil
+	}
+
+	var existing models.IdempotencyKey
+	err := tx.WithContext(ctx).
+		Where("scope = ? AND owner = ? AND key = ?", req.Scope, req.Owner, req.Key).
+		First(&existing).
+		Error
+	if err != nil {
+		return nil, false, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	result = tx.WithContext(ctx).
+		Model(&models.IdempotencyKey{}).
+		Where("id = ?", existing.ID).
+		Where("expires_at < ? OR (status = ? AND request_hash = ? AND (locked_until IS NULL OR locked_until < ?))",
+			now, constants.IdempotencyKeyProcessing, req.RequestHash, now).
+		Updates(map[string]any{
+			"request_hash": req.RequestHash,
+			"status":       constants.IdempotencyKeyProcessing,
+			"response":     nil,
+			"lease":        key.Lease,
+			"locked_until": lockedUntil,
+			"expires_at":   expiresAt,
+		})
+	if result.Error != nil {
+		return nil, false, error2.WrapError(errConstant.ErrSQLError)
+	}
+	if result.RowsAffected > 0 {
+		key.ID = existing.ID
+		return &key, true, nil
+	}
+
+	return &existing, false, nil
+}
+
+// Complete stores the response of the request holding the key and reports
+// false when its lease was taken over in the meantime, in which case the key
+// is left to the request that took it over.
+func (i *IdempotencyKeyRepository) Complete(ctx context.Context, tx *gorm.DB, key *models.IdempotencyKey, response []byte) (bool, error) {
+	result := tx.WithContext(ctx).
+		Model(&models.IdempotencyKey{}).
+		Where("id = ? AND lease = ? AND status = ?", key.ID, key.Lease, constants.IdempotencyKeyProcessing).
+		Updates(map[string]any{
+			"status":   constants.IdempotencyKeyCompleted,
+			"response": string(response),
+		})
+	if result.Error != nil {
+		return false, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// Delete releases the key, unless its lease was taken over in the meantime.
+func (i *IdempotencyKeyRepository) Delete(ctx context.Context, tx *gorm.DB, key *models.IdempotencyKey) error {
+	err := tx.WithContext(ctx).
+		Where("id = ? AND lease = ? AND status = ?", key.ID, key.Lease, constants.IdempotencyKeyProcessing).
+		Delete(&models.IdempotencyKey{}).
+		Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes up to limit keys that expired before the given time
+// and returns how many were deleted.
+func (i *IdempotencyKeyRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	result := i.db.WithContext(ctx).
+		Where("id IN (?)", i.db.Model(&models.IdempotencyKey{}).
+			Select("id").
+			Where("expires_at < ?", before).
+			Limit(limit)).
+		Delete(&models.IdempotencyKey{})
+	if result.Error != nil {
+		return 0, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return int(result.RowsAffected), nil
+}
@@ -0,0 +1,229 @@
+package repositories
+
+import (
+	"context"
+	error2 "payment-service/common/error"
+	"payment-service/constants"
+	errConstant "payment-service/constants/error"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxRepository struct {
+	db *gorm.DB
+}
+
+type IOutboxRepository interface {
+	Create(context.Context, *gorm.DB, *dto.OutboxRequest) error
+	TryLockRelay(context.Context, *gorm.DB) (bool, error)
+	FindPendingForUpdate(context.Context, *gorm.DB, int) ([]models.Outbox, error)
+	Claim(context.Context, *gorm.DB, []uint, uuid.UUID, time.Time) error
+	MarkSent(context.Context, *gorm.DB, uint, uuid.UUID) error
+	MarkFailed(context.Context, *gorm.DB, uint, uuid.UUID, string, time.Time) error
+	MarkDead(context.Context, *gorm.DB, uint, uuid.UUID, string) error
+	Release(context.Context, *gorm.DB, uint, uuid.UUID, *string, time.Time) error
+	Requeue(context.Context, *gorm.DB, uint) (bool, error)
+	Discard(context.Context, *gorm.DB, uint) (bool, error)
+}
+
+func NewOutboxRepository(db *gorm.DB) IOutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+func (o *OutboxRepository) Create(ctx context.Context, tx *gorm.DB, req *dto.OutboxRequest) error {
+	now := time.Now()
+	outbox := models.Outbox{
+		UUID:          uuid.New(),
+		Topic:         req.Topic,
+		Key:           req.Key,
+		Headers:       req.Headers,
+		Payload:       string(req.Payload),
+		Status:        constants.OutboxPending,
+		NextAttemptAt: &now,
+	}
+
+	err := tx.WithContext(ctx).Create(&outbox).Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
+
+// TryLockRelay takes the relay lock until tx ends and reports whether it was
+// free.
+func (o *OutboxRepository) TryLockRelay(ctx context.Context, tx *gorm.DB) (bool, error) {
+	var locked bool
+	err := tx.WithContext(ctx).
+		Raw("SELECT pg_try_advisory_xact_lock(?)", constants.OutboxRelayLock).
+		Scan(&locked).
+		Error
+	if err != nil {
+		return false, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return locked, nil
+}
+
+// FindPendingForUpdate locks up to limit pending messages that are due, in
+// the order they were written. A message waits while an earlier message with
+// the same key is still pending and waiting for its retry, or is dead and
+// neither re-driven nor discarded yet, so that the messages of a key are
+// published in order.
+func (o *OutboxRepository) FindPendingForUpdate(ctx context.Context, tx *gorm.DB, limit int) ([]models.Outbox, error) {
+	var outboxes []models.Outbox
+	now := time.Now()
+	err := tx.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_attempt_at <= ?", constants.OutboxPending, now).
+		Where("key = '' OR NOT EXISTS (?)", tx.Model(&models.Outbox{}).
+			Select("1").
+			Table("outbox AS earlier").
+			Where("earlier.key = outbox.key AND earlier.id < outbox.id").
+			Where("earlier.status = ? OR (earlier.status = ? AND earlier.next_attempt_at > ?)", constants.OutboxDead, constants.OutboxPending, now)).
+		Order("id asc").
+		Limit(limit).
+		Find(&outboxes).
+		Error
+	if err != nil {
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return outboxes, nil
+}
+
+// Claim reserves messages for the relay run identified by claimID until the
+// given time, by postponing their next attempt until then. Claimed messages
+// are not found again, and hold back the later messages of their key, while
+// the run publishes them outside any transaction. Messages of a run that died
+// are found again once the claim runs out.
+func (o *OutboxRepository) Claim(ctx context.Context, tx *gorm.DB, ids []uint, claimID uuid.UUID, until time.Time) error {
+	err := tx.WithContext(ctx).
+		Model(&models.Outbox{}).
+		Where("id IN ?", ids).
+		Updates(map[string]any{
+			"claim_id":        claimID,
+			"next_attempt_at": until,
+		}).
+		Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
+
+// claimed narrows an update down to a message still claimed by claimID, so
+// that a relay run whose claim ran out does not overwrite the outcome of the
+// run that claimed the message after it.
+func claimed(tx *gorm.DB, id uint, claimID uuid.UUID) *gorm.DB {
+	return tx.Model(&models.Outbox{}).Where("id = ? AND claim_id = ? AND status = ?", id, claimID, constants.OutboxPending)
+}
+
+func (o *OutboxRepository) MarkSent(ctx context.Context, tx *gorm.DB, id uint, claimID uuid.UUID) error {
+	err := claimed(tx.WithContext(ctx), id, claimID).
+		Updates(map[string]any{
+			"status":     constants.OutboxSent,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": nil,
+			"claim_id":   nil,
+			"sent_at":    time.Now(),
+		}).
+		Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
+
+func (o *OutboxRepository) MarkFailed(ctx context.Context, tx *gorm.DB, id uint, claimID uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	err := claimed(tx.WithContext(ctx), id, claimID).
+		Updates(map[string]any{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      lastError,
+			"claim_id":        nil,
+			"next_attempt_at": nextAttemptAt,
+		}).
+		Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
+
+func (o *OutboxRepository) MarkDead(ctx context.Context, tx *gorm.DB, id uint, claimID uuid.UUID, lastError string) error {
+	err := claimed(tx.WithContext(ctx), id, claimID).
+		Updates(map[string]any{
+			"status":     constants.OutboxDead,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": lastError,
+			"claim_id":   nil,
+		}).
+		Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
+
+// Release gives up the claim on a message without counting an attempt, e.g.
+// when it was not sent because the broker was unavailable, recording lastError
+// when there is one.
+func (o *OutboxRepository) Release(ctx context.Context, tx *gorm.DB, id uint, claimID uuid.UUID, lastError *string, nextAttemptAt time.Time) error {
+	updates := map[string]any{
+		"claim_id":        nil,
+		"next_attempt_at": nextAttemptAt,
+	}
+	if lastError != nil {
+		updates["last_error"] = *lastError
+	}
+
+	err := claimed(tx.WithContext(ctx), id, claimID).Updates(updates).Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
+
+// Requeue puts a dead message back in line at its original position, so that
+// it is published before the later messages of its key, and reports whether
+// the message was dead.
+func (o *OutboxRepository) Requeue(ctx context.Context, tx *gorm.DB, id uint) (bool, error) {
+	result := tx.WithContext(ctx).
+		Model(&models.Outbox{}).
+		Where("id = ? AND status = ?", id, constants.OutboxDead).
+		Updates(map[string]any{
+			"status":          constants.OutboxPending,
+			"attempts":        0,
+			"claim_id":        nil,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// Discard gives up on a dead message for good, so that it no longer holds back
+// the later messages of its key, and reports whether the message was dead.
+func (o *OutboxRepository) Discard(ctx context.Context, tx *gorm.DB, id uint) (bool, error) {
+	result := tx.WithContext(ctx).
+		Model(&models.Outbox{}).
+		Where("id = ? AND status = ?", id, constants.OutboxDead).
+		Update("status", constants.OutboxDiscarded)
+	if result.Error != nil {
+		return false, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return result.RowsAffected > 0, nil
+}
@@ -3,7 +3,6 @@ package repositories
 import (
 	"context"
 	"errors"
-	"fmt"
 	error2 "payment-service/common/error"
 	"payment-service/constants"
 	errConstant "payment-service/constants/error"
@@ -13,6 +12,7 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaymentRepository struct {
@@ -20,9 +20,14 @@ type PaymentRepository struct {
 }
 
 type IPaymentRepository interface {
-	FindAllWithPagination(context.Context, *dto.PaymentRequestParam) ([]models.Payment, int64, error)
+	FindAllWithPagination(context.Context, *dto.PaymentRequestParam) ([]models.Payment, error)
+	FindAllWithCursor(context.Context, *dto.PaymentRequestParam) ([]models.Payment, error)
+	Count(context.Context, *dto.PaymentRequestParam) (int64, error)
 	FindByUUID(context.Context, string) (*models.Payment, error)
 	FindByOrderID(context.Context, string) (*models.Payment, error)
+	FindByOrderIDForUpdate(context.Context, *gorm.DB, string) (*models.Payment, error)
+	FindForReconcile(context.Context, *dto.ReconcileRequestParam) ([]models.Payment, error)
+	FindExpired(context.Context, *dto.ExpiryRequestParam) ([]models.Payment, error)
 	Create(context.Context, *gorm.DB, *dto.PaymentRequest) (*models.Payment, error)
 	Update(context.Context, *gorm.DB, string, *dto.UpdatePaymentRequest) (*models.Payment, error)
 }
@@ -33,41 +38,128 @@ func NewPaymentRepository(db *gorm.DB) IPaymentRepository {
 	}
 }
 
-func (p *PaymentRepository) FindAllWithPagination(ctx context.Context, param *dto.PaymentRequestParam) ([]models.Payment, int64, error) {
-	var (
-		fields []models.Payment
-		sort   string
-		total  int64
-	)
-	if param.SortColumn != nil {
-		sort = fmt.Sprintf("%s %s", *param.SortColumn, *param.SortOrder)
-	} else {
-		sort = "created_at desc"
-	}
+// FindAllWithPagination returns up to limit+1 payments of the page, so that
+// the caller can tell whether another page follows without counting them.
+func (p *PaymentRepository) FindAllWithPagination(ctx context.Context, param *dto.PaymentRequestParam) ([]models.Payment, error) {
+	var fields []models.Payment
 
 	limit := param.Limit
 	offset := (param.Page - 1) * limit
-	err := p.db.
-		WithContext(ctx).
-		Limit(limit).
+	err := p.filter(p.db.WithContext(ctx), param).
+		Limit(limit + 1).
 		Offset(offset).
-		Order(sort).
+		Order(orderBy(param.SortFields)).
 		Find(&fields).
 		Error
 	if err != nil {
-		return nil, 0, error2.WrapError(errConstant.ErrSQLError)
+		return nil, error2.WrapError(errConstant.ErrSQLError)
 	}
 
-	err = p.db.
-		WithContext(ctx).
-		Model(&fields).
+	return fields, nil
+}
+
+// FindAllWithCursor returns up to limit+1 payments after param.After, newest
+// first, so that the caller can tell whether another page follows. Seeking on
+// (created_at, id) keeps pages stable while new payments arrive.
+func (p *PaymentRepository) FindAllWithCursor(ctx context.Context, param *dto.PaymentRequestParam) ([]models.Payment, error) {
+	var fields []models.Payment
+
+	query := p.filter(p.db.WithContext(ctx), param)
+	if param.After != nil {
+		query = query.Where("(created_at, id) < (?, ?)", param.After.CreatedAt, param.After.ID)
+	}
+
+	err := query.
+		Limit(param.Limit + 1).
+		Order(orderBy(nil)).
+		Find(&fields).
+		Error
+	if err != nil {
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return fields, nil
+}
+
+func (p *PaymentRepository) Count(ctx context.Context, param *dto.PaymentRequestParam) (int64, error) {
+	var total int64
+	err := p.filter(p.db.WithContext(ctx).Model(&models.Payment{}), param).
 		Count(&total).
 		Error
 	if err != nil {
-		return nil, 0, error2.WrapError(errConstant.ErrSQLError)
+		return 0, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return total, nil
+}
+
+// orderBy builds the ORDER BY of the whitelisted sort fields, newest first by
+// default, with id as the tiebreaker so that pages are stable.
+func orderBy(fields []dto.SortField) clause.OrderBy {
+	if len(fields) == 0 {
+		fields = []dto.SortField{{Column: "created_at", Desc: true}}
+	}
+
+	columns := make([]clause.OrderByColumn, 0, len(fields)+1)
+	for _, field := range fields {
+		columns = append(columns, clause.OrderByColumn{Column: clause.Column{Name: field.Column}, Desc: field.Desc})
+	}
+	columns = append(columns, clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: fields[len(fields)-1].Desc})
+
+	return clause.OrderBy{Columns: columns}
+}
+
+// filter narrows the query down to the payments matching the filters of
+// param. The description search uses the full-text index on description.
+func (p *PaymentRepository) filter(query *gorm.DB, param *dto.PaymentRequestParam) *gorm.DB {
+	if len(param.Statuses) > 0 {
+		statuses := make([]constants.PaymentStatus, 0, len(param.Statuses))
+		for _, status := range param.Statuses {
+			statuses = append(statuses, status.GetStatusInt())
+		}
+		query = query.Where("status IN ?", statuses)
+	}
+	if param.OrderID != nil {
+		query = query.Where("order_id = ?", *param.OrderID)
+	}
+	if param.TransactionID != nil {
+		query = query.Where("transaction_id = ?", *param.TransactionID)
+	}
+	if param.Bank != nil {
+		query = query.Where("bank = ?", *param.Bank)
+	}
+	if param.PaymentMethod != nil {
+		query = query.Where("payment_method = ?", *param.PaymentMethod)
+	}
+	if param.MinAmount != nil {
+		query = query.Where("amount >= ?", *param.MinAmount)
+	}
+	if param.MaxAmount != nil {
+		query = query.Where("amount <= ?", *param.MaxAmount)
+	}
+	if param.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *param.CreatedFrom)
+	}
+	if param.CreatedTo != nil {
+		query = query.Where("created_at <= ?", *param.CreatedTo)
+	}
+	if param.PaidFrom != nil {
+		query = query.Where("paid_at >= ?", *param.PaidFrom)
+	}
+	if param.PaidTo != nil {
+		query = query.Where("paid_at <= ?", *param.PaidTo)
+	}
+	if param.ExpiredFrom != nil {
+		query = query.Where("expired_at >= ?", *param.ExpiredFrom)
+	}
+	if param.ExpiredTo != nil {
+		query = query.Where("expired_at <= ?", *param.ExpiredTo)
+	}
+	if param.Search != nil {
+		query = query.Where("to_tsvector('simple', coalesce(description, '')) @@ plainto_tsquery('simple', ?)", *param.Search)
 	}
 
-	return fields, total, nil
+	return query
 }
 
 func (p *PaymentRepository) FindByUUID(ctx context.Context, uuid string) (*models.Payment, error) {
@@ -95,21 +187,85 @@ func (p *PaymentRepository) FindByOrderID(ctx context.Context, orderID string) (
 	return &payment, nil
 }
 
+func (p *PaymentRepository) FindByOrderIDForUpdate(ctx context.Context, tx *gorm.DB, orderID string) (*models.Payment, error) {
+	var payment models.Payment
+	err := tx.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ?", orderID).
+		First(&payment).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, error2.WrapError(error3.ErrPaymentNotFound)
+		}
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return &payment, nil
+}
+
+// FindForReconcile returns the next batch of payments with one of the given
+// statuses, ordered by ID and starting after param.AfterID.
+func (p *PaymentRepository) FindForReconcile(ctx context.Context, param *dto.ReconcileRequestParam) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := p.db.WithContext(ctx).
+		Where("status IN ?", param.Statuses).
+		Where("created_at >= ?", param.CreatedAfter).
+		Where("updated_at <= ?", param.UpdatedBefore).
+		Where("id > ?", param.AfterID).
+		Order("id asc").
+		Limit(param.Limit).
+		Find(&payments).
+		Error
+	if err != nil {
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return payments, nil
+}
+
+// FindExpired returns the next batch of payments with one of the given
+// statuses that expired before param.ExpiredBefore, ordered by ID and
+// starting after param.AfterID. The payments are not locked; each is locked
+// and re-checked when it is expired.
+func (p *PaymentRepository) FindExpired(ctx context.Context, param *dto.ExpiryRequestParam) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := p.db.WithContext(ctx).
+		Where("status IN ?", param.Statuses).
+		Where("expired_at < ?", param.ExpiredBefore).
+		Where("id > ?", param.AfterID).
+		Order("id asc").
+		Limit(param.Limit).
+		Find(&payments).
+		Error
+	if err != nil {
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return payments, nil
+}
+
 func (p *PaymentRepository) Create(ctx context.Context, tx *gorm.DB, request *dto.PaymentRequest) (*models.Payment, error) {
 	status := constants.Initial
 	orderID := uuid.MustParse(request.OrderID)
 	payment := models.Payment{
 		UUID:        uuid.New(),
 		OrderID:     orderID,
-		Amount:      request.Amount,
+		Money:       request.Money,
 		PaymentLink: request.PaymentLink,
 		ExpiredAt:   &request.ExpiredAt,
 		Description: request.Description,
 		Status:      &status,
+		Provider:    request.Provider,
+		CustomerID:  request.CustomerID,
 	}
 
 	err := tx.WithContext(ctx).Create(&payment).Error
 	if err != nil {
+		// Another request created the payment of the order in the meantime.
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, error3.ErrPaymentExists
+		}
 		return nil, error2.WrapError(errConstant.ErrSQLError)
 	}
 	return &payment, nil
@@ -124,6 +280,10 @@ func (p *PaymentRepository) Update(ctx context.Context, tx *gorm.DB, orderID str
 		VANumber:      request.VANumber,
 		Bank:          request.Bank,
 		Acquirer:      request.Acquirer,
+		PaymentMethod: request.PaymentMethod,
+		BillerCode:    request.BillerCode,
+		QRString:      request.QRString,
+		Deeplink:      request.Deeplink,
 	}
 
 	err := tx.WithContext(ctx).Model(&payment).Where("order_id = ?", orderID).Updates(payment).Error
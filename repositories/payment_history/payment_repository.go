@@ -25,6 +25,7 @@ func (r *PaymentHistoryRepository) Create(ctx context.Context, tx *gorm.DB, req
 	paymentHistory := &models.PaymentHistory{
 		PaymentID: req.PaymentID,
 		Status:    req.Status,
+		Note:      req.Note,
 	}
 
 	err := tx.Create(paymentHistory).Error
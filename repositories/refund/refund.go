@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	error2 "payment-service/common/error"
+	"payment-service/constants"
+	errConstant "payment-service/constants/error"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RefundRepository struct {
+	db *gorm.DB
+}
+
+type IRefundRepository interface {
+	Create(context.Context, *gorm.DB, *dto.RefundRequest) (*models.Refund, error)
+	FindByRefundKeyForUpdate(context.Context, *gorm.DB, string) (*models.Refund, error)
+	SumAmountByPaymentID(context.Context, *gorm.DB, uint, ...constants.RefundStatus) (int64, error)
+	Update(context.Context, *gorm.DB, uint, *dto.UpdateRefundRequest) error
+}
+
+func NewRefundRepository(db *gorm.DB) IRefundRepository {
+	return &RefundRepository{db: db}
+}
+
+func (r *RefundRepository) Create(ctx context.Context, tx *gorm.DB, req *dto.RefundRequest) (*models.Refund, error) {
+	refund := models.Refund{
+		UUID:           req.UUID,
+		PaymentID:      req.PaymentID,
+		RefundKey:      req.RefundKey,
+		Money:          req.Money,
+		Reason:         req.Reason,
+		Status:         req.Status,
+		CreditNoteLink: req.CreditNoteLink,
+	}
+
+	err := tx.WithContext(ctx).Create(&refund).Error
+	if err != nil {
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return &refund, nil
+}
+
+func (r *RefundRepository) FindByRefundKeyForUpdate(ctx context.Context, tx *gorm.DB, refundKey string) (*models.Refund, error) {
+	var refund models.Refund
+	err := tx.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("refund_key = ?", refundKey).
+		First(&refund).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errPayment.ErrRefundNotFound
+		}
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return &refund, nil
+}
+
+// SumAmountByPaymentID returns the total amount of the refunds of the payment
+// in any of the given statuses.
+func (r *RefundRepository) SumAmountByPaymentID(ctx context.Context, tx *gorm.DB, paymentID uint, statuses ...constants.RefundStatus) (int64, error) {
+	var total int64
+	err := tx.WithContext(ctx).
+		Model(&models.Refund{}).
+		Where("payment_id = ? AND status IN ?", paymentID, statuses).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&total).
+		Error
+	if err != nil {
+		return 0, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return total, nil
+}
+
+func (r *RefundRepository) Update(ctx context.Context, tx *gorm.DB, id uint, req *dto.UpdateRefundRequest) error {
+	refund := models.Refund{
+		CreditNoteLink: req.CreditNoteLink,
+	}
+	if req.Status != nil {
+		refund.Status = *req.Status
+	}
+
+	err := tx.WithContext(ctx).
+		Model(&models.Refund{}).
+		Where("id = ?", id).
+		Updates(&refund).
+		Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
@@ -2,8 +2,13 @@ package repositories
 
 import (
 	"gorm.io/gorm"
+	repositories5 "payment-service/repositories/dead_letter"
+	repositories7 "payment-service/repositories/idempotency_key"
+	repositories4 "payment-service/repositories/outbox"
 	repositories "payment-service/repositories/payment"
 	repositories2 "payment-service/repositories/payment_history"
+	repositories6 "payment-service/repositories/refund"
+	repositories3 "payment-service/repositories/webhook_event"
 )
 
 type Registry struct {
@@ -13,6 +18,11 @@ type Registry struct {
 type IRepositoryRegistry interface {
 	GetPayment() repositories.IPaymentRepository
 	GetPaymentHistory() repositories2.IPaymentHistoryRepository
+	GetWebhookEvent() repositories3.IWebhookEventRepository
+	GetOutbox() repositories4.IOutboxRepository
+	GetDeadLetter() repositories5.IDeadLetterRepository
+	GetRefund() repositories6.IRefundRepository
+	GetIdempotencyKey() repositories7.IIdempotencyKeyRepository
 	GetTx() *gorm.DB
 }
 
@@ -28,6 +38,26 @@ func (r *Registry) GetPaymentHistory() repositories2.IPaymentHistoryRepository {
 	return repositories2.NewPaymentHistoryRepository(r.db)
 }
 
+func (r *Registry) GetWebhookEvent() repositories3.IWebhookEventRepository {
+	return repositories3.NewWebhookEventRepository(r.db)
+}
+
+func (r *Registry) GetOutbox() repositories4.IOutboxRepository {
+	return repositories4.NewOutboxRepository(r.db)
+}
+
+func (r *Registry) GetDeadLetter() repositories5.IDeadLetterRepository {
+	return repositories5.NewDeadLetterRepository(r.db)
+}
+
+func (r *Registry) GetRefund() repositories6.IRefundRepository {
+	return repositories6.NewRefundRepository(r.db)
+}
+
+func (r *Registry) GetIdempotencyKey() repositories7.IIdempotencyKeyRepository {
+	return repositories7.NewIdempotencyKeyRepository(r.db)
+}
+
 func (r *Registry) GetTx() *gorm.DB {
 	return r.db
 }
@@ -0,0 +1,141 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	error2 "payment-service/common/error"
+	"payment-service/constants"
+	errConstant "payment-service/constants/error"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookEventRepository struct {
+	db *gorm.DB
+}
+
+type IWebhookEventRepository interface {
+	Create(context.Context, *gorm.DB, *dto.WebhookEventRequest) (*models.WebhookEvent, bool, error)
+	FindByUUID(context.Context, string) (*models.WebhookEvent, error)
+	FindAll(context.Context, *dto.WebhookEventRequestParam) ([]models.WebhookEvent, error)
+	FindByIDForUpdate(context.Context, *gorm.DB, uint) (*models.WebhookEvent, error)
+	Update(context.Context, *gorm.DB, uint, *dto.UpdateWebhookEventRequest) error
+}
+
+func NewWebhookEventRepository(db *gorm.DB) IWebhookEventRepository {
+	return &WebhookEventRepository{db: db}
+}
+
+// Create stores a raw notification. When a notification with the same
+// notification key was already stored, the existing row is returned and the
+// boolean result is false.
+func (w *WebhookEventRepository) Create(ctx context.Context, tx *gorm.DB, req *dto.WebhookEventRequest) (*models.WebhookEvent, bool, error) {
+	event := models.WebhookEvent{
+		UUID:              uuid.New(),
+		Provider:          req.Provider,
+		OrderID:           req.OrderID,
+		TransactionID:     req.TransactionID,
+		TransactionStatus: req.TransactionStatus,
+		NotificationKey:   &req.NotificationKey,
+		Payload:           string(req.Payload),
+		Status:            constants.WebhookEventReceived,
+	}
+
+	result := tx.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&event)
+	if result.Error != nil {
+		return nil, false, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	if result.RowsAffected > 0 {
+		return &event, true, nil
+	}
+
+	var existing models.WebhookEvent
+	err := tx.WithContext(ctx).
+		Where("notification_key = ?", req.NotificationKey).
+		First(&existing).
+		Error
+	if err != nil {
+		return nil, false, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return &existing, false, nil
+}
+
+func (w *WebhookEventRepository) FindByUUID(ctx context.Context, uuid string) (*models.WebhookEvent, error) {
+	var event models.WebhookEvent
+	err := w.db.WithContext(ctx).Where("uuid = ?", uuid).First(&event).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, error2.WrapError(errPayment.ErrWebhookEventNotFound)
+		}
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return &event, nil
+}
+
+func (w *WebhookEventRepository) FindAll(ctx context.Context, param *dto.WebhookEventRequestParam) ([]models.WebhookEvent, error) {
+	var events []models.WebhookEvent
+	query := w.db.WithContext(ctx)
+	if param.OrderID != nil {
+		query = query.Where("order_id = ?", *param.OrderID)
+	}
+	if param.Since != nil {
+		query = query.Where("created_at >= ?", *param.Since)
+	}
+	if len(param.Statuses) > 0 {
+		query = query.Where("status IN ?", param.Statuses)
+	}
+
+	err := query.Order("created_at asc, id asc").Find(&events).Error
+	if err != nil {
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return events, nil
+}
+
+func (w *WebhookEventRepository) FindByIDForUpdate(ctx context.Context, tx *gorm.DB, id uint) (*models.WebhookEvent, error) {
+	var event models.WebhookEvent
+	err := tx.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&event).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, error2.WrapError(errPayment.ErrWebhookEventNotFound)
+		}
+		return nil, error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return &event, nil
+}
+
+func (w *WebhookEventRepository) Update(ctx context.Context, tx *gorm.DB, id uint, req *dto.UpdateWebhookEventRequest) error {
+	updates := map[string]any{
+		"status": req.Status,
+		"error":  req.Error,
+	}
+	if req.Status == constants.WebhookEventProcessed {
+		updates["processed_at"] = time.Now()
+	}
+
+	err := tx.WithContext(ctx).
+		Model(&models.WebhookEvent{}).
+		Where("id = ?", id).
+		Updates(updates).
+		Error
+	if err != nil {
+		return error2.WrapError(errConstant.ErrSQLError)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"payment-service/clients"
+	"payment-service/constants"
+	controllers "payment-service/controllers/http"
+	"payment-service/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminRoutes struct {
+	controller controllers.IControllerRegistry
+	client     clients.IClientRegistry
+	group      *gin.RouterGroup
+}
+
+type IAdminRoutes interface {
+	Run()
+}
+
+func NewAdminRoutes(group *gin.RouterGroup, controller controllers.IControllerRegistry, client clients.IClientRegistry) IAdminRoutes {
+	return &AdminRoutes{
+		group:      group,
+		controller: controller,
+		client:     client,
+	}
+}
+
+func (a *AdminRoutes) Run() {
+	group := a.group.Group("/admin")
+
+	group.Use(middlewares.Authenticate())
+	group.Use(middlewares.CheckRole([]string{constants.Admin}, a.client))
+	group.POST("/webhooks/:id/replay", a.controller.GetPayment().ReplayWebhook)
+}
@@ -29,10 +29,14 @@ func NewPaymentRoutes(group *gin.RouterGroup, controller controllers.IController
 
 func (p *PaymentRoutes) Run() {
 	p.group.POST("/webhook", p.controller.GetPayment().Webhook)
+	p.group.POST("/webhook/:provider", p.controller.GetPayment().Webhook)
 	group := p.group.Group("/payments")
 
 	group.Use(middlewares.Authenticate())
 	group.GET("", middlewares.CheckRole([]string{constants.Admin, constants.Customer}, p.client), p.controller.GetPayment().GetAllWithPagination)
 	group.GET("/:uuid", middlewares.CheckRole([]string{constants.Admin, constants.Customer}, p.client), p.controller.GetPayment().GetByUUID)
 	group.POST("", middlewares.CheckRole([]string{constants.Customer}, p.client), p.controller.GetPayment().Create)
+	group.POST("/charge", middlewares.CheckRole([]string{constants.Customer}, p.client), p.controller.GetPayment().Charge)
+	group.POST("/:uuid/cancel", middlewares.CheckRole([]string{constants.Admin, constants.Customer}, p.client), p.controller.GetPayment().Cancel)
+	group.POST("/:uuid/refunds", middlewares.CheckRole([]string{constants.Admin}, p.client), p.controller.GetPayment().Refund)
 }
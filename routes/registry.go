@@ -2,8 +2,12 @@ package routes
 
 import (
 	"payment-service/clients"
+	"payment-service/config"
+	"payment-service/constants"
 	controllers "payment-service/controllers/http"
+	adminRoutes "payment-service/routes/admin"
 	routes "payment-service/routes/payment"
+	sandboxRoutes "payment-service/routes/sandbox"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,8 +32,20 @@ func NewRouteRegistry(controller controllers.IControllerRegistry, group *gin.Rou
 
 func (r *Registry) Serve() {
 	r.paymentRoute().Run()
+	r.adminRoute().Run()
+	if config.Config.PaymentGateway.DefaultProvider == constants.FakeProvider.String() {
+		r.sandboxRoute().Run()
+	}
 }
 
 func (r *Registry) paymentRoute() routes.IPaymentRoutes {
 	return routes.NewPaymentRoutes(r.group, r.controller, r.client)
 }
+
+func (r *Registry) adminRoute() adminRoutes.IAdminRoutes {
+	return adminRoutes.NewAdminRoutes(r.group, r.controller, r.client)
+}
+
+func (r *Registry) sandboxRoute() sandboxRoutes.ISandboxRoutes {
+	return sandboxRoutes.NewSandboxRoutes(r.group, r.controller)
+}
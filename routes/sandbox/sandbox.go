@@ -0,0 +1,31 @@
+package routes
+
+import (
+	controllers "payment-service/controllers/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SandboxRoutes serves the endpoints used to drive payments of the fake
+// gateway during local development. They are only registered when the fake
+// gateway is enabled.
+type SandboxRoutes struct {
+	controller controllers.IControllerRegistry
+	group      *gin.RouterGroup
+}
+
+type ISandboxRoutes interface {
+	Run()
+}
+
+func NewSandboxRoutes(group *gin.RouterGroup, controller controllers.IControllerRegistry) ISandboxRoutes {
+	return &SandboxRoutes{
+		group:      group,
+		controller: controller,
+	}
+}
+
+func (s *SandboxRoutes) Run() {
+	group := s.group.Group("/sandbox")
+	group.POST("/payments/:uuid/simulate", s.controller.GetPayment().Simulate)
+}
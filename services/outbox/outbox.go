@@ -0,0 +1,479 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"payment-service/config"
+	errConstant "payment-service/constants/error"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/controllers/kafka"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"payment-service/repositories"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRelayInterval = time.Second
+	defaultBatchSize     = 100
+	defaultMaxAttempts   = 10
+	defaultClaimTimeout  = time.Minute
+	maxRetryBackoff      = 5 * time.Minute
+)
+
+// EventHandler handles an event consumed from a topic this service does not
+// own. Handling an event twice must be harmless.
+type EventHandler func(context.Context, []byte) error
+
+type OutboxService struct {
+	repository repositories.IRepositoryRegistry
+	kafka      kafka.IKafkaRegistry
+	handlers   map[string]EventHandler
+}
+
+type IOutboxService interface {
+	Relay(context.Context) (int, error)
+	Run(context.Context)
+	RedriveDeadLetters(context.Context, *dto.DeadLetterRequestParam) (int, error)
+	Redrive(context.Context, *dto.DeadLetterMessage) error
+	DeadLetter(context.Context, *dto.DeadLetterMessage) error
+	Discard(context.Context, uint) error
+}
+
+// NewOutboxService creates the outbox service. handlers maps each consumed
+// topic to the handler its dead letters are re-driven into.
+func NewOutboxService(
+	repository repositories.IRepositoryRegistry,
+	kafka kafka.IKafkaRegistry,
+	handlers map[string]EventHandler,
+) IOutboxService {
+	return &OutboxService{
+		repository: repository,
+		kafka:      kafka,
+		handlers:   handlers,
+	}
+}
+
+func (o *OutboxService) batchSize() int {
+	if config.Config.Outbox.BatchSize > 0 {
+		return config.Config.Outbox.BatchSize
+	}
+	return defaultBatchSize
+}
+
+func (o *OutboxService) relayInterval() time.Duration {
+	if config.Config.Outbox.RelayIntervalInMs > 0 {
+		return time.Duration(config.Config.Outbox.RelayIntervalInMs) * time.Millisecond
+	}
+	return defaultRelayInterval
+}
+
+func (o *OutboxService) maxAttempts() int {
+	if config.Config.Outbox.MaxAttempts > 0 {
+		return config.Config.Outbox.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+// claimTimeout is how long a relay run may take to publish its batch before
+// the messages it claimed are claimed again by another run.
+func (o *OutboxService) claimTimeout() time.Duration {
+	if config.Config.Outbox.ClaimTimeoutInMs > 0 {
+		return time.Duration(config.Config.Outbox.ClaimTimeoutInMs) * time.Millisecond
+	}
+	return defaultClaimTimeout
+}
+
+// retryBackoff doubles the delay before the next attempt with every failed
+// attempt, capped at maxRetryBackoff.
+func (o *OutboxService) retryBackoff(attempts int) time.Duration {
+	backoff := time.Second
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
+
+// result is what publishing a claimed message came to.
+type result int
+
+const (
+	// resultReleased messages were not published, e.g. because an earlier
+	// message failed or the broker is unavailable, and are retried without
+	// counting an attempt.
+	resultReleased result = iota
+	resultSent
+	resultFailed
+	resultDead
+)
+
+type published struct {
+	outbox     models.Outbox
+	result     result
+	err        error
+	deadLetter *dto.DeadLetterMessage
+	// stored reports whether the dead letter still has to be stored in the
+	// dead_letters table, because it was not published to the dead-letter
+	// topic.
+	stored bool
+}
+
+// Relay publishes one batch of pending outbox messages and returns how many
+// were sent. The batch is claimed in a short transaction, published outside
+// any transaction, and its outcome recorded in a second one, so that neither
+// row locks nor the relay lock are held while Kafka is called. A message waits
+// for the earlier messages of its key, so that the events of an order are
+// published in order. Publishing stops at the first failure; the failed
+// message is retried later and holds back the later messages of its key until
+// then. A message that fails for the last allowed time is dead-lettered and
+// keeps holding back its key until it is re-driven or discarded. While the
+// broker is unavailable, nothing counts as an attempt, so that an outage of
+// any length dead-letters nothing; Relay then returns ErrBrokerUnavailable.
+func (o *OutboxService) Relay(ctx context.Context) (int, error) {
+	claimID := uuid.New()
+	claimedUntil := time.Now().Add(o.claimTimeout())
+	outboxes, err := o.claim(ctx, claimID, claimedUntil)
+	if err != nil || len(outboxes) == 0 {
+		return 0, err
+	}
+
+	results, unavailable := o.publish(outboxes, claimedUntil)
+
+	sent := 0
+	err = o.repository.GetTx().Transaction(func(tx *gorm.DB) error {
+		sent = 0
+		for _, result := range results {
+			err := o.record(ctx, tx, claimID, &result)
+			if err != nil {
+				return err
+			}
+			if result.result == resultSent {
+				sent++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if unavailable != nil {
+		return sent, fmt.Errorf("%w: %v", errConstant.ErrBrokerUnavailable, unavailable)
+	}
+	return sent, nil
+}
+
+// claim takes the relay lock and claims the next batch of pending messages in
+// a transaction of its own.
+func (o *OutboxService) claim(ctx context.Context, claimID uuid.UUID, claimedUntil time.Time) ([]models.Outbox, error) {
+	var outboxes []models.Outbox
+	err := o.repository.GetTx().Transaction(func(tx *gorm.DB) error {
+		locked, err := o.repository.GetOutbox().TryLockRelay(ctx, tx)
+		if err != nil || !locked {
+			return err
+		}
+
+		outboxes, err = o.repository.GetOutbox().FindPendingForUpdate(ctx, tx, o.batchSize())
+		if err != nil || len(outboxes) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(outboxes))
+		for _, outbox := range outboxes {
+			ids = append(ids, outbox.ID)
+		}
+		return o.repository.GetOutbox().Claim(ctx, tx, ids, claimID, claimedUntil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return outboxes, nil
+}
+
+// publish sends the claimed messages in order until the first failure or
+// until the claim runs out, and returns the result of every message along
+// with the error of an unavailable broker, if any.
+func (o *OutboxService) publish(outboxes []models.Outbox, claimedUntil time.Time) ([]published, error) {
+	results := make([]published, 0, len(outboxes))
+	var unavailable error
+	stopped := false
+
+	// A message dead-lettered in this batch holds back the later messages of
+	// its key in the batch as well.
+	deadKeys := make(map[string]bool)
+	for _, outbox := range outboxes {
+		if stopped || deadKeys[outbox.Key] || time.Now().After(claimedUntil) {
+			results = append(results, published{outbox: outbox, result: resultReleased})
+			continue
+		}
+
+		err := o.kafka.GetKafkaProducer().ProduceMessage(&kafka.Message{
+			Topic:   outbox.Topic,
+			Key:     outbox.Key,
+			Headers: outbox.Headers,
+			Value:   []byte(outbox.Payload),
+		})
+		switch {
+		case err == nil:
+			results = append(results, published{outbox: outbox, result: resultSent})
+		case kafka.IsUnavailable(err):
+			logrus.Errorf("broker unavailable while relaying outbox message %s, retrying without counting an attempt: %v", outbox.UUID, err)
+			results = append(results, published{outbox: outbox, result: resultReleased, err: err})
+			unavailable = err
+			stopped = true
+		case outbox.Attempts+1 >= o.maxAttempts():
+			deadLetter := o.newDeadLetter(&outbox, err)
+			results = append(results, published{
+				outbox:     outbox,
+				result:     resultDead,
+				err:        err,
+				deadLetter: deadLetter,
+				stored:     !o.publishDeadLetter(deadLetter),
+			})
+			if outbox.Key != "" {
+				deadKeys[outbox.Key] = true
+			}
+		default:
+			results = append(results, published{outbox: outbox, result: resultFailed, err: err})
+			stopped = true
+		}
+	}
+
+	return results, unavailable
+}
+
+// record stores the result of publishing a claimed message.
+func (o *OutboxService) record(ctx context.Context, tx *gorm.DB, claimID uuid.UUID, result *published) error {
+	outbox := &result.outbox
+	switch result.result {
+	case resultSent:
+		return o.repository.GetOutbox().MarkSent(ctx, tx, outbox.ID, claimID)
+	case resultFailed:
+		nextAttemptAt := time.Now().Add(o.retryBackoff(outbox.Attempts + 1))
+		logrus.Errorf("failed to relay outbox message %s (attempt %d), retrying at %s: %v",
+			outbox.UUID, outbox.Attempts+1, nextAttemptAt.Format(time.RFC3339), result.err)
+		return o.repository.GetOutbox().MarkFailed(ctx, tx, outbox.ID, claimID, result.err.Error(), nextAttemptAt)
+	case resultDead:
+		if result.stored {
+			err := o.storeDeadLetter(ctx, tx, result.deadLetter)
+			if err != nil {
+				return err
+			}
+		}
+		return o.repository.GetOutbox().MarkDead(ctx, tx, outbox.ID, claimID, result.err.Error())
+	default:
+		var lastError *string
+		if result.err != nil {
+			message := result.err.Error()
+			lastError = &message
+		}
+		return o.repository.GetOutbox().Release(ctx, tx, outbox.ID, claimID, lastError, time.Now())
+	}
+}
+
+// newDeadLetter gives up on an outbox message that failed maxAttempts times.
+func (o *OutboxService) newDeadLetter(outbox *models.Outbox, cause error) *dto.DeadLetterMessage {
+	return &dto.DeadLetterMessage{
+		ID:       uuid.New(),
+		OutboxID: outbox.ID,
+		Topic:    outbox.Topic,
+		Key:      outbox.Key,
+		Headers:  outbox.Headers,
+		Payload:  json.RawMessage(outbox.Payload),
+		Error:    cause.Error(),
+		Attempts: outbox.Attempts + 1,
+		FailedAt: time.Now(),
+	}
+}
+
+// DeadLetter gives up on a message that cannot be handled, e.g. a consumed
+// event that keeps failing, so that it can be re-driven later.
+func (o *OutboxService) DeadLetter(ctx context.Context, message *dto.DeadLetterMessage) error {
+	if o.publishDeadLetter(message) {
+		return nil
+	}
+	return o.storeDeadLetter(ctx, o.repository.GetTx(), message)
+}
+
+// publishDeadLetter publishes a dead letter to the dead-letter topic and
+// reports whether it was published. Without a dead-letter topic, or when the
+// broker refuses it, the dead letter has to be stored instead.
+func (o *OutboxService) publishDeadLetter(message *dto.DeadLetterMessage) bool {
+	topic := config.Config.Kafka.DeadLetterTopic
+	if topic == "" {
+		return false
+	}
+
+	value, err := json.Marshal(message)
+	if err == nil {
+		err = o.kafka.GetKafkaProducer().ProduceMessage(&kafka.Message{
+			Topic:   topic,
+			Key:     message.Key,
+			Headers: message.Headers,
+			Value:   value,
+		})
+	}
+	if err != nil {
+		logrus.Errorf("failed to publish dead letter %s to dead-letter topic %s, storing it instead: %v",
+			message.ID, topic, err)
+		return false
+	}
+
+	logrus.Warnf("message for topic %s failed %d times and was published to dead-letter topic %s: %s",
+		message.Topic, message.Attempts, topic, message.Error)
+	return true
+}
+
+// storeDeadLetter stores a dead letter in the dead_letters table.
+func (o *OutboxService) storeDeadLetter(ctx context.Context, tx *gorm.DB, message *dto.DeadLetterMessage) error {
+	err := o.repository.GetDeadLetter().Create(ctx, tx, message)
+	if err != nil {
+		return err
+	}
+
+	logrus.Warnf("message for topic %s failed %d times and was stored as dead letter %s: %s",
+		message.Topic, message.Attempts, message.ID, message.Error)
+	return nil
+}
+
+// Run relays pending outbox messages until ctx is cancelled. A full batch is
+// followed immediately by the next one; otherwise it waits for the relay
+// interval. While the broker is unavailable, it backs off for longer the
+// longer the outage lasts.
+func (o *OutboxService) Run(ctx context.Context) {
+	logrus.Infof("outbox relay started")
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	outages := 0
+	for {
+		select {
+		case <-ctx.Done():
+			logrus.Infof("outbox relay stopped")
+			return
+		case <-timer.C:
+		}
+
+		sent, err := o.Relay(ctx)
+		if errors.Is(err, errConstant.ErrBrokerUnavailable) {
+			outages++
+			timer.Reset(o.retryBackoff(outages))
+			continue
+		}
+		outages = 0
+		if err != nil {
+			logrus.Errorf("outbox relay failed: %v", err)
+		}
+
+		if err == nil && sent == o.batchSize() {
+			timer.Reset(0)
+			continue
+		}
+		timer.Reset(o.relayInterval())
+	}
+}
+
+// RedriveDeadLetters re-drives the dead letters stored in the database, or
+// only the one matching param.UUID, and returns how many were re-driven.
+func (o *OutboxService) RedriveDeadLetters(ctx context.Context, param *dto.DeadLetterRequestParam) (int, error) {
+	deadLetters, err := o.repository.GetDeadLetter().FindNotRedriven(ctx, param)
+	if err != nil {
+		return 0, err
+	}
+
+	redriven := 0
+	for _, deadLetter := range deadLetters {
+		err = o.repository.GetTx().Transaction(func(tx *gorm.DB) error {
+			err = o.redrive(ctx, tx, &dto.DeadLetterMessage{
+				ID:       deadLetter.UUID,
+				OutboxID: deadLetter.OutboxID,
+				Topic:    deadLetter.Topic,
+				Key:      deadLetter.Key,
+				Headers:  deadLetter.Headers,
+				Payload:  json.RawMessage(deadLetter.Payload),
+			})
+			if err != nil {
+				return err
+			}
+
+			return o.repository.GetDeadLetter().MarkRedriven(ctx, tx, deadLetter.ID)
+		})
+		if err != nil {
+			return redriven, err
+		}
+
+		redriven++
+	}
+
+	return redriven, nil
+}
+
+// Redrive re-drives a dead letter consumed from the dead-letter topic.
+func (o *OutboxService) Redrive(ctx context.Context, message *dto.DeadLetterMessage) error {
+	return o.redrive(ctx, o.repository.GetTx(), message)
+}
+
+// redrive puts a dead outbox message back in line at its original position,
+// so that the relay publishes it before the later messages of its key. A
+// dead letter of a consumed event is handed to the handler of its topic
+// instead, since the topics this service consumes are not its own to publish
+// to. Re-driving a message that was already re-driven or discarded does
+// nothing.
+func (o *OutboxService) redrive(ctx context.Context, tx *gorm.DB, message *dto.DeadLetterMessage) error {
+	if message.OutboxID == 0 {
+		handler, ok := o.handlers[message.Topic]
+		if !ok {
+			return fmt.Errorf("%w: %s", errPayment.ErrUnknownDeadLetterTopic, message.Topic)
+		}
+
+		err := handler(ctx, message.Payload)
+		if err != nil {
+			return err
+		}
+
+		logrus.Infof("re-drove dead letter %s consumed from topic %s", message.ID, message.Topic)
+		return nil
+	}
+
+	requeued, err := o.repository.GetOutbox().Requeue(ctx, tx, message.OutboxID)
+	if err != nil {
+		return err
+	}
+	if !requeued {
+		logrus.Warnf("outbox message %d of dead letter %s was already re-driven or discarded, skipping",
+			message.OutboxID, message.ID)
+		return nil
+	}
+
+	logrus.Infof("re-drove dead letter %s as outbox message %d to topic %s", message.ID, message.OutboxID, message.Topic)
+	return nil
+}
+
+// Discard gives up on a dead outbox message for good, so that the later
+// messages of its key are published without it.
+func (o *OutboxService) Discard(ctx context.Context, outboxID uint) error {
+	return o.repository.GetTx().Transaction(func(tx *gorm.DB) error {
+		discarded, err := o.repository.GetOutbox().Discard(ctx, tx, outboxID)
+		if err != nil {
+			return err
+		}
+		if !discarded {
+			return errPayment.ErrDeadLetterNotFound
+		}
+
+		err = o.repository.GetDeadLetter().MarkDiscarded(ctx, tx, outboxID)
+		if err != nil {
+			return err
+		}
+
+		logrus.Warnf("discarded dead outbox message %d", outboxID)
+		return nil
+	})
+}
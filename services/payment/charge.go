@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+
+	"gorm.io/gorm"
+)
+
+// Charge creates a payment with a direct charge at the gateway. Instead of a
+// payment link, the customer gets the virtual account, QR string or e-wallet
+// deeplink to pay with, which the app can render natively. With an
+// idempotency key, a retry of the same request returns the original response
+// instead of charging again; see idempotent.
+func (p *PaymentService) Charge(ctx context.Context, request *dto.ChargeRequest) (*dto.PaymentResponse, error) {
+	return p.idempotent(ctx, constants.IdempotencyScopeChargePayment, request.IdempotencyKey, request, func() (*dto.PaymentResponse, error) {
+		return p.charge(ctx, request)
+	})
+}
+
+func (p *PaymentService) charge(ctx context.Context, request *dto.ChargeRequest) (*dto.PaymentResponse, error) {
+	if !request.PaymentMethod.IsValid() {
+		return nil, errPayment.ErrInvalidChargeMethod
+	}
+
+	err := p.validatePaymentRequest(&request.PaymentRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentGateway, err := p.gateway.Get(request.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	var payment *models.Payment
+	err = p.repository.GetTx().Transaction(func(tx *gorm.DB) error {
+		txErr := p.ensureNewOrder(ctx, request.OrderID)
+		if txErr != nil {
+			return txErr
+		}
+
+		charge, txErr := paymentGateway.Charge(request)
+		if txErr != nil {
+			return txErr
+		}
+
+		payment, txErr = p.repository.GetPayment().Create(ctx, tx, &dto.PaymentRequest{
+			OrderID:     request.OrderID,
+			Money:       request.Money,
+			Description: request.Description,
+			ExpiredAt:   request.ExpiredAt,
+			Provider:    paymentGateway.Provider(),
+			CustomerID:  p.customerID(ctx),
+		})
+		if txErr != nil {
+			return txErr
+		}
+
+		_, txErr = p.repository.GetPayment().Update(ctx, tx, request.OrderID, &dto.UpdatePaymentRequest{
+			TransactionID: &charge.TransactionID,
+			PaymentMethod: &charge.PaymentMethod,
+			VANumber:      charge.VANumber,
+			Bank:          charge.Bank,
+			BillerCode:    charge.BillerCode,
+			QRString:      charge.QRString,
+			Deeplink:      charge.Deeplink,
+		})
+		if txErr != nil {
+			return txErr
+		}
+
+		return p.repository.GetPaymentHistory().Create(ctx, tx, &dto.PaymentHistoryRequest{
+			PaymentID: payment.ID,
+			Status:    payment.Status.GetStatusString(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.GetByUUID(ctx, payment.UUID.String())
+}
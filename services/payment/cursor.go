@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"payment-service/common/util"
+	errConstant "payment-service/constants/error"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+
+	"github.com/sirupsen/logrus"
+)
+
+// GetAllWithCursor pages through payments by cursor, newest first. Unlike
+// offset pages, a page does not shift while new payments arrive and does not
+// get slower the further it is, so reports can page through every payment.
+func (p *PaymentService) GetAllWithCursor(ctx context.Context, param *dto.PaymentRequestParam) (*util.CursorPaginationResult, error) {
+	err := p.validateFilters(param)
+	if err != nil {
+		return nil, err
+	}
+
+	sortFields, err := p.parseSort(param)
+	if err != nil {
+		return nil, err
+	}
+	if len(sortFields) > 0 {
+		return nil, errPayment.ErrCursorSort
+	}
+
+	if param.Cursor != nil && *param.Cursor != "" {
+		var after dto.PaymentCursor
+		err = util.DecodeCursor(*param.Cursor, &after)
+		if err != nil || after.ID == 0 {
+			return nil, errPayment.ErrInvalidCursor
+		}
+		param.After = &after
+	}
+
+	payments, err := p.repository.GetPayment().FindAllWithCursor(ctx, param)
+	if err != nil {
+		return nil, err
+	}
+
+	var nextCursor *string
+	if len(payments) > param.Limit {
+		payments = payments[:param.Limit]
+		last := payments[len(payments)-1]
+		if last.CreatedAt == nil {
+			logrus.Errorf("payment %s has no created_at, cannot page past it", last.UUID)
+			return nil, errConstant.ErrInternalServerError
+		}
+		cursor, err := util.EncodeCursor(dto.PaymentCursor{CreatedAt: *last.CreatedAt, ID: last.ID})
+		if err != nil {
+			return nil, err
+		}
+		nextCursor = &cursor
+	}
+
+	var total *int64
+	if param.WithCount != nil && *param.WithCount {
+		count, err := p.repository.GetPayment().Count(ctx, param)
+		if err != nil {
+			return nil, err
+		}
+		total = &count
+	}
+
+	response := util.GenerateCursorPagination(util.CursorPaginationParams{
+		Count:      total,
+		Limit:      param.Limit,
+		NextCursor: nextCursor,
+		Data:       p.toPaymentResponses(payments),
+	})
+
+	return &response, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"payment-service/common/eventschema"
+	"payment-service/config"
+	"payment-service/constants"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (p *PaymentService) mapTransactionStatusToEvent(status constants.PaymentStatusString) string {
+	if !status.IsValid() {
+		return "UNKNOWN STATUS"
+	}
+	return strings.ToUpper(status.String())
+}
+
+// correlationID returns the ID of the HTTP request being served, or a new one
+// when the event does not originate from a request, e.g. a CLI replay.
+func (p *PaymentService) correlationID(ctx context.Context) string {
+	requestID, ok := ctx.Value(constants.RequestID).(string)
+	if ok && requestID != "" {
+		return requestID
+	}
+	return uuid.NewString()
+}
+
+func (p *PaymentService) eventVersion() string {
+	if config.Config.Kafka.EventVersion == "" {
+		return constants.KafkaEventVersionV1
+	}
+	return config.Config.Kafka.EventVersion
+}
+
+func (p *PaymentService) buildEventV1(status constants.PaymentStatusString, payment *models.Payment) ([]byte, error) {
+	kafkaMessage := dto.KafkaMessage{
+		Event: dto.KafkaEvent{
+			Name: p.mapTransactionStatusToEvent(status),
+		},
+		MetaData: dto.KafkaMetaData{
+			Sender:    constants.KafkaSender,
+			SendingAt: time.Now().Format(time.RFC3339),
+		},
+		Body: dto.KafkaBody{
+			Type: "JSON",
+			Data: &dto.KafkaData{
+				OrderID:   payment.OrderID,
+				PaymentID: payment.UUID,
+				Status:    status.String(),
+				PaidAt:    payment.PaidAt,
+				ExpiredAt: *payment.ExpiredAt,
+			},
+		},
+	}
+
+	return json.Marshal(kafkaMessage)
+}
+
+func (p *PaymentService) buildEventV2(status constants.PaymentStatusString, payment *models.Payment, correlationID string) ([]byte, error) {
+	event := dto.PaymentEvent{
+		SpecVersion:     constants.CloudEventsSpecVersion,
+		ID:              uuid.New(),
+		Source:          constants.KafkaSender,
+		Type:            fmt.Sprintf("payment.%s", status),
+		Subject:         payment.OrderID.String(),
+		Time:            time.Now(),
+		DataContentType: "application/json",
+		DataSchema:      constants.PaymentEventSchemaV2,
+		CorrelationID:   correlationID,
+		Data: dto.PaymentEventData{
+			Event:         p.mapTransactionStatusToEvent(status),
+			OrderID:       payment.OrderID,
+			PaymentID:     payment.UUID,
+			Status:        status.String(),
+			Money:         payment.Money,
+			PaymentMethod: payment.PaymentMethod,
+			Bank:          payment.Bank,
+			VANumber:      payment.VANumber,
+			InvoiceLink:   payment.InvoiceLink,
+			TransactionID: payment.TransactionID,
+			Description:   payment.Description,
+			PaidAt:        payment.PaidAt,
+			ExpiredAt:     payment.ExpiredAt,
+			CreatedAt:     payment.CreatedAt,
+			UpdatedAt:     payment.UpdatedAt,
+		},
+	}
+
+	return json.Marshal(event)
+}
+
+// produceToOutbox writes the payment event to the outbox in the caller's
+// transaction, using the event version selected in the Kafka config. The
+// event is validated against its JSON Schema before it is stored.
+func (p *PaymentService) produceToOutbox(ctx context.Context, tx *gorm.DB, status constants.PaymentStatusString, payment *models.Payment) error {
+	var (
+		version       = p.eventVersion()
+		correlationID = p.correlationID(ctx)
+		payload       []byte
+		err           error
+	)
+
+	switch version {
+	case constants.KafkaEventVersionV1:
+		payload, err = p.buildEventV1(status, payment)
+	case constants.KafkaEventVersionV2:
+		payload, err = p.buildEventV2(status, payment, correlationID)
+	default:
+		err = fmt.Errorf("%w: %s", eventschema.ErrUnknownSchema, version)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = eventschema.Validate(version, payload)
+	if err != nil {
+		return err
+	}
+
+	return p.repository.GetOutbox().Create(ctx, tx, &dto.OutboxRequest{
+		Topic: config.Config.Kafka.Topic,
+		Key:   payment.OrderID.String(),
+		Headers: map[string]string{
+			constants.KafkaHeaderEventName:     p.mapTransactionStatusToEvent(status),
+			constants.KafkaHeaderSchemaVersion: version,
+			constants.KafkaHeaderSender:        constants.KafkaSender,
+			constants.KafkaHeaderCorrelationID: correlationID,
+		},
+		Payload: payload,
+	})
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+	"payment-service/config"
+	"payment-service/constants"
+	"testing"
+)
+
+func TestProduceToOutboxMatchesTheEventSchema(t *testing.T) {
+	for _, version := range []string{constants.KafkaEventVersionV1, constants.KafkaEventVersionV2} {
+		t.Run(version, func(t *testing.T) {
+			kafkaConfig := config.Config.Kafka
+			config.Config.Kafka.EventVersion = version
+			t.Cleanup(func() { config.Config.Kafka = kafkaConfig })
+
+			env := newTestEnv(t, fakeGatewayRegistry{})
+			for _, status := range []constants.PaymentStatus{constants.Pending, constants.Settlement} {
+				payment := env.addPayment(status, 150000, constants.FakeProvider)
+				err := env.service.produceToOutbox(context.Background(), env.service.repository.GetTx(), status.GetStatusString(), &payment)
+				if err != nil {
+					t.Errorf("produceToOutbox() of a %s payment error = %v", status.GetStatusString(), err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"payment-service/config"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultExpirySweepInterval = time.Minute
+	defaultExpiryBatchSize     = 100
+)
+
+func (p *PaymentService) expirySweepInterval() time.Duration {
+	if config.Config.Expiry.SweepIntervalInSeconds > 0 {
+		return time.Duration(config.Config.Expiry.SweepIntervalInSeconds) * time.Second
+	}
+	return defaultExpirySweepInterval
+}
+
+func (p *PaymentService) expiryBatchSize() int {
+	if config.Config.Expiry.BatchSize > 0 {
+		return config.Config.Expiry.BatchSize
+	}
+	return defaultExpiryBatchSize
+}
+
+// ExpireOverdue expires the initial and pending payments whose ExpiredAt has
+// passed and returns how many were expired. Each payment is expired at its
+// gateway first, outside any transaction, and then locally in a short
+// transaction of its own that re-checks its status, so that no lock is held
+// while the gateway is called and one payment failing never undoes another.
+// A payment the gateway refuses to expire, e.g. because it was paid in the
+// meantime, or that fails locally after the gateway expired it, is left for
+// the webhook or the reconciler.
+func (p *PaymentService) ExpireOverdue(ctx context.Context) (int, error) {
+	param := &dto.ExpiryRequestParam{
+		Statuses:      []constants.PaymentStatus{constants.Initial, constants.Pending},
+		ExpiredBefore: time.Now(),
+		Limit:         p.expiryBatchSize(),
+	}
+
+	expired := 0
+	for {
+		payments, err := p.repository.GetPayment().FindExpired(ctx, param)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, payment := range payments {
+			if ctx.Err() != nil {
+				return expired, ctx.Err()
+			}
+
+			param.AfterID = payment.ID
+			ok, err := p.expirePayment(ctx, &payment)
+			if err != nil {
+				return expired, err
+			}
+			if ok {
+				expired++
+			}
+		}
+
+		if len(payments) < param.Limit || ctx.Err() != nil {
+			return expired, ctx.Err()
+		}
+	}
+}
+
+// expirePayment expires a payment at its gateway, then locally. It returns
+// false when the gateway refused to expire it, or when the payment moved on in
+// the meantime, and true only once the local expiry has committed.
+func (p *PaymentService) expirePayment(ctx context.Context, payment *models.Payment) (bool, error) {
+	orderID := payment.OrderID.String()
+	paymentGateway, err := p.gateway.Get(payment.Provider)
+	if err != nil {
+		return false, err
+	}
+
+	err = paymentGateway.Cancel(orderID, *payment.Status)
+	if errors.Is(err, errPayment.ErrGatewayTransactionNotFound) {
+		logrus.Infof("order %s has no transaction at %s, expiring locally only", orderID, payment.Provider)
+	} else if err != nil {
+		logrus.Warnf("failed to expire order %s at %s, skipping: %v", orderID, payment.Provider, err)
+		return false, nil
+	}
+
+	expired := false
+	err = p.repository.GetTx().Transaction(func(tx *gorm.DB) error {
+		payment, txErr := p.repository.GetPayment().FindByOrderIDForUpdate(ctx, tx, orderID)
+		if txErr != nil {
+			return txErr
+		}
+
+		// A webhook may have moved the payment on while the gateway was
+		// called.
+		if !payment.Status.CanTransitionTo(constants.Expire) {
+			logrus.Infof("order %s moved to %s before it expired, skipping", orderID, payment.Status.GetStatusString())
+			return nil
+		}
+
+		status := constants.Expire
+		_, txErr = p.repository.GetPayment().Update(ctx, tx, orderID, &dto.UpdatePaymentRequest{
+			Status: &status,
+		})
+		if txErr != nil {
+			return txErr
+		}
+
+		note := "payment expired"
+		txErr = p.repository.GetPaymentHistory().Create(ctx, tx, &dto.PaymentHistoryRequest{
+			PaymentID: payment.ID,
+			Status:    constants.ExpireString,
+			Note:      &note,
+		})
+		if txErr != nil {
+			return txErr
+		}
+
+		payment.Status = &status
+		txErr = p.produceToOutbox(ctx, tx, constants.ExpireString, payment)
+		if txErr != nil {
+			return txErr
+		}
+
+		expired = true
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("order %s expired at %s but not locally: %v", orderID, payment.Provider, err)
+		return false, err
+	}
+
+	return expired, nil
+}
+
+// RunExpirySweeper expires overdue payments and deletes expired idempotency
+// keys every sweep interval until ctx is cancelled.
+func (p *PaymentService) RunExpirySweeper(ctx context.Context) {
+	logrus.Infof("payment expiry sweeper started")
+	ticker := time.NewTicker(p.expirySweepInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logrus.Infof("payment expiry sweeper stopped")
+			return
+		case <-ticker.C:
+		}
+
+		expired, err := p.ExpireOverdue(ctx)
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorf("payment expiry sweep failed: %v", err)
+		}
+		if expired > 0 {
+			logrus.Infof("expired %d overdue payments", expired)
+		}
+
+		purged, err := p.purgeIdempotencyKeys(ctx)
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorf("idempotency key purge failed: %v", err)
+		}
+		if purged > 0 {
+			logrus.Infof("purged %d expired idempotency keys", purged)
+		}
+	}
+}
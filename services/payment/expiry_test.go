@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func overdue(payment *models.Payment) {
+	expiredAt := time.Now().Add(-time.Minute)
+	payment.ExpiredAt = &expiredAt
+}
+
+func TestExpireOverdue(t *testing.T) {
+	paymentGateway := newFakeGateway()
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: paymentGateway})
+
+	initial := env.addPayment(constants.Initial, 150000, constants.FakeProvider)
+	pending := env.addPayment(constants.Pending, 150000, constants.FakeProvider)
+	settled := env.addPayment(constants.Settlement, 150000, constants.FakeProvider)
+	notDue := env.addPayment(constants.Pending, 150000, constants.FakeProvider)
+	for _, payment := range []models.Payment{initial, pending, settled} {
+		env.updatePayment(payment.ID, overdue)
+	}
+
+	paymentGateway.onCancel = func(string) error {
+		if env.inTransaction() {
+			t.Error("gateway called inside a transaction")
+		}
+		return nil
+	}
+
+	expired, err := env.service.ExpireOverdue(context.Background())
+	if err != nil {
+		t.Fatalf("ExpireOverdue() error = %v", err)
+	}
+	if expired != 2 {
+		t.Errorf("ExpireOverdue() = %d, want 2", expired)
+	}
+
+	for _, tt := range []struct {
+		payment models.Payment
+		want    constants.PaymentStatus
+	}{
+		{payment: initial, want: constants.Expire},
+		{payment: pending, want: constants.Expire},
+		{payment: settled, want: constants.Settlement},
+		{payment: notDue, want: constants.Pending},
+	} {
+		got := env.payment(t, tt.payment.OrderID)
+		if *got.Status != tt.want {
+			t.Errorf("payment %d = %s, want %s", tt.payment.ID, got.Status.GetStatusString(), tt.want.GetStatusString())
+		}
+	}
+
+	events := env.outbox()
+	if len(events) != 2 || events[0].Key != initial.OrderID.String() || events[1].Key != pending.OrderID.String() {
+		t.Errorf("outbox = %v, want the expiry of payments %d and %d", events, initial.ID, pending.ID)
+	}
+	if len(env.histories(initial.ID)) != 1 {
+		t.Errorf("histories of payment %d = %v, want one", initial.ID, env.histories(initial.ID))
+	}
+}
+
+func TestExpireOverdueSkipsPaymentsTheGatewayRefuses(t *testing.T) {
+	paymentGateway := newFakeGateway()
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: paymentGateway})
+
+	refused := env.addPayment(constants.Pending, 150000, constants.FakeProvider)
+	accepted := env.addPayment(constants.Pending, 150000, constants.FakeProvider)
+	env.updatePayment(refused.ID, overdue)
+	env.updatePayment(accepted.ID, overdue)
+
+	paymentGateway.onCancel = func(orderID string) error {
+		if orderID == refused.OrderID.String() {
+			return fmt.Errorf("%w: transaction is already settlement", errPayment.ErrGatewayRejected)
+		}
+		return nil
+	}
+
+	expired, err := env.service.ExpireOverdue(context.Background())
+	if err != nil || expired != 1 {
+		t.Fatalf("ExpireOverdue() = %d, %v, want 1, nil", expired, err)
+	}
+	if got := env.payment(t, refused.OrderID); *got.Status != constants.Pending {
+		t.Errorf("refused payment = %s, want pending", got.Status.GetStatusString())
+	}
+	if got := env.payment(t, accepted.OrderID); *got.Status != constants.Expire {
+		t.Errorf("accepted payment = %s, want expire", got.Status.GetStatusString())
+	}
+}
+
+func TestExpireOverdueRechecksPaymentsPaidMeanwhile(t *testing.T) {
+	paymentGateway := newFakeGateway()
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: paymentGateway})
+
+	payment := env.addPayment(constants.Pending, 150000, constants.FakeProvider)
+	env.updatePayment(payment.ID, overdue)
+
+	// The settlement webhook is processed while the gateway is called.
+	paymentGateway.onCancel = func(string) error {
+		env.updatePayment(payment.ID, func(payment *models.Payment) {
+			status := constants.Settlement
+			payment.Status = &status
+		})
+		return nil
+	}
+
+	expired, err := env.service.ExpireOverdue(context.Background())
+	if err != nil || expired != 0 {
+		t.Fatalf("ExpireOverdue() = %d, %v, want 0, nil", expired, err)
+	}
+	if got := env.payment(t, payment.OrderID); *got.Status != constants.Settlement {
+		t.Errorf("payment = %s, want settlement", got.Status.GetStatusString())
+	}
+	if len(env.outbox()) != 0 {
+		t.Errorf("outbox = %v, want empty", env.outbox())
+	}
+}
+
+func TestExpireOverdueKeepsCommittedExpiriesWhenOneFails(t *testing.T) {
+	paymentGateway := newFakeGateway()
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: paymentGateway})
+
+	first := env.addPayment(constants.Pending, 150000, constants.FakeProvider)
+	second := env.addPayment(constants.Pending, 150000, constants.FakeProvider)
+	env.updatePayment(first.ID, overdue)
+	env.updatePayment(second.ID, overdue)
+
+	failure := errors.New("connection reset")
+	env.store.failOutbox = func(key string) error {
+		if key == second.OrderID.String() {
+			return failure
+		}
+		return nil
+	}
+
+	expired, err := env.service.ExpireOverdue(context.Background())
+	if !errors.Is(err, failure) || expired != 1 {
+		t.Fatalf("ExpireOverdue() = %d, %v, want 1, %v", expired, err, failure)
+	}
+	if got := env.payment(t, first.OrderID); *got.Status != constants.Expire {
+		t.Errorf("first payment = %s, want expire", got.Status.GetStatusString())
+	}
+	if got := env.payment(t, second.OrderID); *got.Status != constants.Pending {
+		t.Errorf("second payment = %s, want pending", got.Status.GetStatusString())
+	}
+	if !slices.Equal(paymentGateway.cancels, []string{first.OrderID.String(), second.OrderID.String()}) {
+		t.Errorf("gateway cancels = %v, want both payments", paymentGateway.cancels)
+	}
+}
@@ -0,0 +1,1111 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	fakeClient "payment-service/clients/fake"
+	"payment-service/clients/gateway"
+	"payment-service/common/money"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/controllers/kafka"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"payment-service/repositories"
+	deadLetterRepository "payment-service/repositories/dead_letter"
+	idempotencyKeyRepository "payment-service/repositories/idempotency_key"
+	outboxRepository "payment-service/repositories/outbox"
+	paymentRepository "payment-service/repositories/payment"
+	paymentHistoryRepository "payment-service/repositories/payment_history"
+	refundRepository "payment-service/repositories/refund"
+	webhookEventRepository "payment-service/repositories/webhook_event"
+	outboxService "payment-service/services/outbox"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// fakeState holds the rows of the fake repositories.
+type fakeState struct {
+	nextID          uint
+	payments        map[uint]models.Payment
+	histories       []models.PaymentHistory
+	webhookEvents   map[uint]models.WebhookEvent
+	outbox          map[uint]models.Outbox
+	deadLetters     map[uint]models.DeadLetter
+	refunds         map[uint]models.Refund
+	idempotencyKeys map[uint]models.IdempotencyKey
+}
+
+func (s *fakeState) clone() fakeState {
+	return fakeState{
+		nextID:          s.nextID,
+		payments:        maps.Clone(s.payments),
+		histories:       slices.Clone(s.histories),
+		webhookEvents:   maps.Clone(s.webhookEvents),
+		outbox:          maps.Clone(s.outbox),
+		deadLetters:     maps.Clone(s.deadLetters),
+		refunds:         maps.Clone(s.refunds),
+		idempotencyKeys: maps.Clone(s.idempotencyKeys),
+	}
+}
+
+// fakeStore is an in-memory database for the fake repositories. Its
+// transactions are real gorm transactions over a connection that never runs
+// SQL: beginning one snapshots the rows and rolling it back restores them, so
+// that tests see what a rolled back transaction leaves behind.
+type fakeStore struct {
+	mu        sync.Mutex
+	state     fakeState
+	snapshots []fakeState
+	commits   int
+	rollbacks int
+
+	// failOutbox, when set, fails writing the outbox message of the order.
+	failOutbox func(key string) error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		state: fakeState{
+			payments:        make(map[uint]models.Payment),
+			webhookEvents:   make(map[uint]models.WebhookEvent),
+			outbox:          make(map[uint]models.Outbox),
+			deadLetters:     make(map[uint]models.DeadLetter),
+			refunds:         make(map[uint]models.Refund),
+			idempotencyKeys: make(map[uint]models.IdempotencyKey),
+		},
+	}
+}
+
+func (s *fakeStore) id() uint {
+	s.state.nextID++
+	return s.state.nextID
+}
+
+func (s *fakeStore) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshots = append(s.snapshots, s.state.clone())
+	return &fakeTx{fakeConn: fakeConn{}, store: s}, nil
+}
+
+// fakeConn is a connection that fails every statement, so that a repository
+// bypassing the fakes is noticed.
+type fakeConn struct{}
+
+func (fakeConn) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, fmt.Errorf("fake database runs no SQL")
+}
+
+func (fakeConn) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, fmt.Errorf("fake database runs no SQL")
+}
+
+func (fakeConn) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, fmt.Errorf("fake database runs no SQL")
+}
+
+func (fakeConn) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+type fakePool struct {
+	fakeConn
+	store *fakeStore
+}
+
+func (p *fakePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return p.store.BeginTx(ctx, opts)
+}
+
+type fakeTx struct {
+	fakeConn
+	store *fakeStore
+	done  bool
+}
+
+func (t *fakeTx) Commit() error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	t.done = true
+	t.store.snapshots = t.store.snapshots[:len(t.store.snapshots)-1]
+	t.store.commits++
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	if t.done {
+		return nil
+	}
+	t.done = true
+	last := len(t.store.snapshots) - 1
+	t.store.state = t.store.snapshots[last]
+	t.store.snapshots = t.store.snapshots[:last]
+	t.store.rollbacks++
+	return nil
+}
+
+type fakeDialector struct {
+	pool *fakePool
+}
+
+func (d fakeDialector) Name() string { return "fake" }
+
+func (d fakeDialector) Initialize(db *gorm.DB) error {
+	db.ConnPool = d.pool
+	return nil
+}
+
+func (d fakeDialector) Migrator(*gorm.DB) gorm.Migrator { return nil }
+
+func (d fakeDialector) DataTypeOf(*schema.Field) string { return "" }
+
+func (d fakeDialector) DefaultValueOf(*schema.Field) clause.Expression { return nil }
+
+func (d fakeDialector) BindVarTo(writer clause.Writer, _ *gorm.Statement, _ interface{}) {
+	_ = writer.WriteByte('?')
+}
+
+func (d fakeDialector) QuoteTo(writer clause.Writer, str string) {
+	_, _ = writer.WriteString(str)
+}
+
+func (d fakeDialector) Explain(sql string, _ ...interface{}) string { return sql }
+
+// fakeRegistry implements the repository registry over a fakeStore.
+type fakeRegistry struct {
+	store *fakeStore
+	db    *gorm.DB
+}
+
+func newFakeRegistry(t *testing.T, store *fakeStore) *fakeRegistry {
+	t.Helper()
+
+	db, err := gorm.Open(fakeDialector{pool: &fakePool{store: store}}, &gorm.Config{
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	if err != nil {
+		t.Fatalf("failed to open the fake database: %v", err)
+	}
+
+	return &fakeRegistry{store: store, db: db}
+}
+
+func (r *fakeRegistry) GetPayment() paymentRepository.IPaymentRepository {
+	return &fakePaymentRepository{r.store}
+}
+
+func (r *fakeRegistry) GetPaymentHistory() paymentHistoryRepository.IPaymentHistoryRepository {
+	return &fakePaymentHistoryRepository{r.store}
+}
+
+func (r *fakeRegistry) GetWebhookEvent() webhookEventRepository.IWebhookEventRepository {
+	return &fakeWebhookEventRepository{r.store}
+}
+
+func (r *fakeRegistry) GetOutbox() outboxRepository.IOutboxRepository {
+	return &fakeOutboxRepository{r.store}
+}
+
+func (r *fakeRegistry) GetDeadLetter() deadLetterRepository.IDeadLetterRepository {
+	return &fakeDeadLetterRepository{r.store}
+}
+
+func (r *fakeRegistry) GetRefund() refundRepository.IRefundRepository {
+	return &fakeRefundRepository{r.store}
+}
+
+func (r *fakeRegistry) GetIdempotencyKey() idempotencyKeyRepository.IIdempotencyKeyRepository {
+	return &fakeIdempotencyKeyRepository{r.store}
+}
+
+func (r *fakeRegistry) GetTx() *gorm.DB {
+	return r.db
+}
+
+var _ repositories.IRepositoryRegistry = (*fakeRegistry)(nil)
+
+type fakePaymentRepository struct {
+	s *fakeStore
+}
+
+func (f *fakePaymentRepository) FindAllWithPagination(context.Context, *dto.PaymentRequestParam) ([]models.Payment, error) {
+	return nil, nil
+}
+
+func (f *fakePaymentRepository) FindAllWithCursor(context.Context, *dto.PaymentRequestParam) ([]models.Payment, error) {
+	return nil, nil
+}
+
+func (f *fakePaymentRepository) Count(context.Context, *dto.PaymentRequestParam) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakePaymentRepository) find(match func(models.Payment) bool) (*models.Payment, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	for _, payment := range f.s.state.payments {
+		if match(payment) {
+			return &payment, nil
+		}
+	}
+	return nil, errPayment.ErrPaymentNotFound
+}
+
+func (f *fakePaymentRepository) FindByUUID(_ context.Context, id string) (*models.Payment, error) {
+	return f.find(func(payment models.Payment) bool { return payment.UUID.String() == id })
+}
+
+func (f *fakePaymentRepository) FindByOrderID(_ context.Context, orderID string) (*models.Payment, error) {
+	return f.find(func(payment models.Payment) bool { return payment.OrderID.String() == orderID })
+}
+
+func (f *fakePaymentRepository) FindByOrderIDForUpdate(ctx context.Context, _ *gorm.DB, orderID string) (*models.Payment, error) {
+	return f.FindByOrderID(ctx, orderID)
+}
+
+func (f *fakePaymentRepository) FindForReconcile(context.Context, *dto.ReconcileRequestParam) ([]models.Payment, error) {
+	return nil, nil
+}
+
+func (f *fakePaymentRepository) FindExpired(_ context.Context, param *dto.ExpiryRequestParam) ([]models.Payment, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	payments := make([]models.Payment, 0)
+	for _, payment := range f.s.state.payments {
+		if slices.Contains(param.Statuses, *payment.Status) && payment.ExpiredAt.Before(param.ExpiredBefore) && payment.ID > param.AfterID {
+			payments = append(payments, payment)
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool { return payments[i].ID < payments[j].ID })
+	if len(payments) > param.Limit {
+		payments = payments[:param.Limit]
+	}
+
+	return payments, nil
+}
+
+func (f *fakePaymentRepository) Create(_ context.Context, _ *gorm.DB, request *dto.PaymentRequest) (*models.Payment, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	orderID := uuid.MustParse(request.OrderID)
+	for _, payment := range f.s.state.payments {
+		if payment.OrderID == orderID {
+			return nil, errPayment.ErrPaymentExists
+		}
+	}
+
+	now := time.Now()
+	status := constants.Initial
+	payment := models.Payment{
+		ID:          f.s.id(),
+		UUID:        uuid.New(),
+		OrderID:     orderID,
+		Money:       request.Money,
+		PaymentLink: request.PaymentLink,
+		ExpiredAt:   &request.ExpiredAt,
+		Description: request.Description,
+		Status:      &status,
+		Provider:    request.Provider,
+		CustomerID:  request.CustomerID,
+		CreatedAt:   &now,
+		UpdatedAt:   &now,
+	}
+	f.s.state.payments[payment.ID] = payment
+
+	return &payment, nil
+}
+
+func (f *fakePaymentRepository) Update(_ context.Context, _ *gorm.DB, orderID string, request *dto.UpdatePaymentRequest) (*models.Payment, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	for id, payment := range f.s.state.payments {
+		if payment.OrderID.String() != orderID {
+			continue
+		}
+
+		set := func(field **string, value *string) {
+			if value != nil {
+				*field = value
+			}
+		}
+		if request.Status != nil {
+			payment.Status = request.Status
+		}
+		if request.PaidAt != nil {
+			payment.PaidAt = request.PaidAt
+		}
+		set(&payment.TransactionID, request.TransactionID)
+		set(&payment.InvoiceLink, request.InvoiceLink)
+		set(&payment.VANumber, request.VANumber)
+		set(&payment.Bank, request.Bank)
+		set(&payment.Acquirer, request.Acquirer)
+		set(&payment.PaymentMethod, request.PaymentMethod)
+		set(&payment.BillerCode, request.BillerCode)
+		set(&payment.QRString, request.QRString)
+		set(&payment.Deeplink, request.Deeplink)
+		now := time.Now()
+		payment.UpdatedAt = &now
+		f.s.state.payments[id] = payment
+	}
+
+	return &models.Payment{}, nil
+}
+
+type fakePaymentHistoryRepository struct {
+	s *fakeStore
+}
+
+func (f *fakePaymentHistoryRepository) Create(_ context.Context, _ *gorm.DB, request *dto.PaymentHistoryRequest) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	f.s.state.histories = append(f.s.state.histories, models.PaymentHistory{
+		ID:        f.s.id(),
+		PaymentID: request.PaymentID,
+		Status:    request.Status,
+		Note:      request.Note,
+	})
+	return nil
+}
+
+type fakeWebhookEventRepository struct {
+	s *fakeStore
+}
+
+func (f *fakeWebhookEventRepository) Create(_ context.Context, _ *gorm.DB, request *dto.WebhookEventRequest) (*models.WebhookEvent, bool, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	for _, event := range f.s.state.webhookEvents {
+		if *event.NotificationKey == request.NotificationKey {
+			return &event, false, nil
+		}
+	}
+
+	key := request.NotificationKey
+	event := models.WebhookEvent{
+		ID:                f.s.id(),
+		UUID:              uuid.New(),
+		Provider:          request.Provider,
+		OrderID:           request.OrderID,
+		TransactionID:     request.TransactionID,
+		TransactionStatus: request.TransactionStatus,
+		NotificationKey:   &key,
+		Payload:           string(request.Payload),
+		Status:            constants.WebhookEventReceived,
+	}
+	f.s.state.webhookEvents[event.ID] = event
+
+	return &event, true, nil
+}
+
+func (f *fakeWebhookEventRepository) FindByUUID(_ context.Context, id string) (*models.WebhookEvent, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	for _, event := range f.s.state.webhookEvents {
+		if event.UUID.String() == id {
+			return &event, nil
+		}
+	}
+	return nil, errPayment.ErrWebhookEventNotFound
+}
+
+func (f *fakeWebhookEventRepository) FindAll(context.Context, *dto.WebhookEventRequestParam) ([]models.WebhookEvent, error) {
+	return nil, nil
+}
+
+func (f *fakeWebhookEventRepository) FindByIDForUpdate(_ context.Context, _ *gorm.DB, id uint) (*models.WebhookEvent, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	event, ok := f.s.state.webhookEvents[id]
+	if !ok {
+		return nil, errPayment.ErrWebhookEventNotFound
+	}
+	return &event, nil
+}
+
+func (f *fakeWebhookEventRepository) Update(_ context.Context, _ *gorm.DB, id uint, request *dto.UpdateWebhookEventRequest) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	event := f.s.state.webhookEvents[id]
+	event.Status = request.Status
+	event.Error = request.Error
+	f.s.state.webhookEvents[id] = event
+	return nil
+}
+
+type fakeOutboxRepository struct {
+	s *fakeStore
+}
+
+func (f *fakeOutboxRepository) Create(_ context.Context, _ *gorm.DB, request *dto.OutboxRequest) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	if f.s.failOutbox != nil {
+		err := f.s.failOutbox(request.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	id := f.s.id()
+	now := time.Now()
+	f.s.state.outbox[id] = models.Outbox{
+		ID:            id,
+		UUID:          uuid.New(),
+		Topic:         request.Topic,
+		Key:           request.Key,
+		Headers:       request.Headers,
+		Payload:       string(request.Payload),
+		Status:        constants.OutboxPending,
+		NextAttemptAt: &now,
+	}
+	return nil
+}
+
+func (f *fakeOutboxRepository) TryLockRelay(context.Context, *gorm.DB) (bool, error) {
+	return true, nil
+}
+
+// FindPendingForUpdate holds back the messages of a key behind an earlier one
+// that is dead or waiting for its retry, like the SQL does.
+func (f *fakeOutboxRepository) FindPendingForUpdate(_ context.Context, _ *gorm.DB, limit int) ([]models.Outbox, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	now := time.Now()
+	waiting := func(outbox models.Outbox) bool {
+		return outbox.Status == constants.OutboxDead ||
+			outbox.Status == constants.OutboxPending && outbox.NextAttemptAt.After(now)
+	}
+
+	outboxes := make([]models.Outbox, 0)
+	for _, outbox := range f.s.state.outbox {
+		if outbox.Status != constants.OutboxPending || outbox.NextAttemptAt.After(now) {
+			continue
+		}
+		blocked := slices.ContainsFunc(slices.Collect(maps.Values(f.s.state.outbox)), func(earlier models.Outbox) bool {
+			return outbox.Key != "" && earlier.Key == outbox.Key && earlier.ID < outbox.ID && waiting(earlier)
+		})
+		if !blocked {
+			outboxes = append(outboxes, outbox)
+		}
+	}
+
+	sort.Slice(outboxes, func(i, j int) bool { return outboxes[i].ID < outboxes[j].ID })
+	return outboxes[:min(limit, len(outboxes))], nil
+}
+
+func (f *fakeOutboxRepository) update(id uint, update func(*models.Outbox) bool) bool {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	outbox, ok := f.s.state.outbox[id]
+	if !ok || !update(&outbox) {
+		return false
+	}
+	f.s.state.outbox[id] = outbox
+	return true
+}
+
+func (f *fakeOutboxRepository) Claim(_ context.Context, _ *gorm.DB, ids []uint, claimID uuid.UUID, until time.Time) error {
+	for _, id := range ids {
+		f.update(id, func(outbox *models.Outbox) bool {
+			outbox.ClaimID = &claimID
+			outbox.NextAttemptAt = &until
+			return true
+		})
+	}
+	return nil
+}
+
+// claimed updates a message only while it is still claimed by claimID, like
+// the SQL does.
+func (f *fakeOutboxRepository) claimed(id uint, claimID uuid.UUID, update func(*models.Outbox)) {
+	f.update(id, func(outbox *models.Outbox) bool {
+		if outbox.Status != constants.OutboxPending || outbox.ClaimID == nil || *outbox.ClaimID != claimID {
+			return false
+		}
+		update(outbox)
+		outbox.ClaimID = nil
+		return true
+	})
+}
+
+func (f *fakeOutboxRepository) MarkSent(_ context.Context, _ *gorm.DB, id uint, claimID uuid.UUID) error {
+	f.claimed(id, claimID, func(outbox *models.Outbox) {
+		now := time.Now()
+		outbox.Status = constants.OutboxSent
+		outbox.Attempts++
+		outbox.LastError = nil
+		outbox.SentAt = &now
+	})
+	return nil
+}
+
+func (f *fakeOutboxRepository) MarkFailed(_ context.Context, _ *gorm.DB, id uint, claimID uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	f.claimed(id, claimID, func(outbox *models.Outbox) {
+		outbox.Attempts++
+		outbox.LastError = &lastError
+		outbox.NextAttemptAt = &nextAttemptAt
+	})
+	return nil
+}
+
+func (f *fakeOutboxRepository) MarkDead(_ context.Context, _ *gorm.DB, id uint, claimID uuid.UUID, lastError string) error {
+	f.claimed(id, claimID, func(outbox *models.Outbox) {
+		outbox.Status = constants.OutboxDead
+		outbox.Attempts++
+		outbox.LastError = &lastError
+	})
+	return nil
+}
+
+func (f *fakeOutboxRepository) Release(_ context.Context, _ *gorm.DB, id uint, claimID uuid.UUID, lastError *string, nextAttemptAt time.Time) error {
+	f.claimed(id, claimID, func(outbox *models.Outbox) {
+		if lastError != nil {
+			outbox.LastError = lastError
+		}
+		outbox.NextAttemptAt = &nextAttemptAt
+	})
+	return nil
+}
+
+func (f *fakeOutboxRepository) Requeue(_ context.Context, _ *gorm.DB, id uint) (bool, error) {
+	return f.update(id, func(outbox *models.Outbox) bool {
+		if outbox.Status != constants.OutboxDead {
+			return false
+		}
+		now := time.Now()
+		outbox.Status = constants.OutboxPending
+		outbox.Attempts = 0
+		outbox.ClaimID = nil
+		outbox.NextAttemptAt = &now
+		return true
+	}), nil
+}
+
+func (f *fakeOutboxRepository) Discard(_ context.Context, _ *gorm.DB, id uint) (bool, error) {
+	return f.update(id, func(outbox *models.Outbox) bool {
+		if outbox.Status != constants.OutboxDead {
+			return false
+		}
+		outbox.Status = constants.OutboxDiscarded
+		return true
+	}), nil
+}
+
+type fakeDeadLetterRepository struct {
+	s *fakeStore
+}
+
+func (f *fakeDeadLetterRepository) Create(_ context.Context, _ *gorm.DB, request *dto.DeadLetterMessage) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	id := f.s.id()
+	f.s.state.deadLetters[id] = models.DeadLetter{
+		ID:       id,
+		UUID:     request.ID,
+		OutboxID: request.OutboxID,
+		Topic:    request.Topic,
+		Key:      request.Key,
+		Headers:  request.Headers,
+		Payload:  string(request.Payload),
+		Error:    request.Error,
+		Attempts: request.Attempts,
+	}
+	return nil
+}
+
+func (f *fakeDeadLetterRepository) FindNotRedriven(_ context.Context, param *dto.DeadLetterRequestParam) ([]models.DeadLetter, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	deadLetters := make([]models.DeadLetter, 0)
+	for _, deadLetter := range f.s.state.deadLetters {
+		if deadLetter.RedrivenAt != nil || deadLetter.DiscardedAt != nil {
+			continue
+		}
+		if param.UUID != nil && deadLetter.UUID.String() != *param.UUID {
+			continue
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	sort.Slice(deadLetters, func(i, j int) bool { return deadLetters[i].ID < deadLetters[j].ID })
+	return deadLetters, nil
+}
+
+func (f *fakeDeadLetterRepository) MarkRedriven(_ context.Context, _ *gorm.DB, id uint) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	deadLetter := f.s.state.deadLetters[id]
+	now := time.Now()
+	deadLetter.RedrivenAt = &now
+	f.s.state.deadLetters[id] = deadLetter
+	return nil
+}
+
+func (f *fakeDeadLetterRepository) MarkDiscarded(_ context.Context, _ *gorm.DB, outboxID uint) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	now := time.Now()
+	for id, deadLetter := range f.s.state.deadLetters {
+		if deadLetter.OutboxID == outboxID && deadLetter.RedrivenAt == nil && deadLetter.DiscardedAt == nil {
+			deadLetter.DiscardedAt = &now
+			f.s.state.deadLetters[id] = deadLetter
+		}
+	}
+	return nil
+}
+
+type fakeRefundRepository struct {
+	s *fakeStore
+}
+
+func (f *fakeRefundRepository) Create(_ context.Context, _ *gorm.DB, request *dto.RefundRequest) (*models.Refund, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	for _, refund := range f.s.state.refunds {
+		if refund.RefundKey == request.RefundKey {
+			return nil, fmt.Errorf("duplicate refund key %s", request.RefundKey)
+		}
+	}
+
+	now := time.Now()
+	refund := models.Refund{
+		ID:             f.s.id(),
+		UUID:           request.UUID,
+		PaymentID:      request.PaymentID,
+		RefundKey:      request.RefundKey,
+		Money:          request.Money,
+		Reason:         request.Reason,
+		Status:         request.Status,
+		CreditNoteLink: request.CreditNoteLink,
+		CreatedAt:      &now,
+	}
+	f.s.state.refunds[refund.ID] = refund
+
+	return &refund, nil
+}
+
+func (f *fakeRefundRepository) FindByRefundKeyForUpdate(_ context.Context, _ *gorm.DB, refundKey string) (*models.Refund, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	for _, refund := range f.s.state.refunds {
+		if refund.RefundKey == refundKey {
+			return &refund, nil
+		}
+	}
+	return nil, errPayment.ErrRefundNotFound
+}
+
+func (f *fakeRefundRepository) SumAmountByPaymentID(_ context.Context, _ *gorm.DB, paymentID uint, statuses ...constants.RefundStatus) (int64, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	var total int64
+	for _, refund := range f.s.state.refunds {
+		if refund.PaymentID == paymentID && slices.Contains(statuses, refund.Status) {
+			total += refund.Amount
+		}
+	}
+	return total, nil
+}
+
+func (f *fakeRefundRepository) Update(_ context.Context, _ *gorm.DB, id uint, request *dto.UpdateRefundRequest) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	refund := f.s.state.refunds[id]
+	if request.Status != nil {
+		refund.Status = *request.Status
+	}
+	if request.CreditNoteLink != nil {
+		refund.CreditNoteLink = request.CreditNoteLink
+	}
+	f.s.state.refunds[id] = refund
+	return nil
+}
+
+type fakeIdempotencyKeyRepository struct {
+	s *fakeStore
+}
+
+func (f *fakeIdempotencyKeyRepository) Create(_ context.Context, _ *gorm.DB, request *dto.IdempotencyKeyRequest) (*models.IdempotencyKey, bool, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	now := time.Now()
+	lockedUntil := now.Add(constants.IdempotencyKeyLease)
+	expiresAt := now.Add(constants.IdempotencyKeyTTL)
+	claimed := models.IdempotencyKey{
+		Scope:       request.Scope,
+		Owner:       request.Owner,
+		Key:         request.Key,
+		RequestHash: request.RequestHash,
+		Status:      constants.IdempotencyKeyProcessing,
+		Lease:       uuid.New(),
+		LockedUntil: &lockedUntil,
+		ExpiresAt:   &expiresAt,
+		CreatedAt:   &now,
+	}
+
+	for id, key := range f.s.state.idempotencyKeys {
+		if key.Scope != request.Scope || key.Owner != request.Owner || key.Key != request.Key {
+			continue
+		}
+		if key.ExpiresAt.Before(now) || key.Status == constants.IdempotencyKeyProcessing && key.RequestHash == request.RequestHash &&
+			(key.LockedUntil == nil || key.LockedUntil.Before(now)) {
+			claimed.ID = id
+			f.s.state.idempotencyKeys[id] = claimed
+			return &claimed, true, nil
+		}
+		return &key, false, nil
+	}
+
+	claimed.ID = f.s.id()
+	f.s.state.idempotencyKeys[claimed.ID] = claimed
+	return &claimed, true, nil
+}
+
+// held reports whether key still holds its lease.
+func (f *fakeIdempotencyKeyRepository) held(key *models.IdempotencyKey) bool {
+	stored, ok := f.s.state.idempotencyKeys[key.ID]
+	return ok && stored.Lease == key.Lease && stored.Status == constants.IdempotencyKeyProcessing
+}
+
+func (f *fakeIdempotencyKeyRepository) Complete(_ context.Context, _ *gorm.DB, key *models.IdempotencyKey, response []byte) (bool, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	if !f.held(key) {
+		return false, nil
+	}
+
+	stored := f.s.state.idempotencyKeys[key.ID]
+	body := string(response)
+	stored.Status = constants.IdempotencyKeyCompleted
+	stored.Response = &body
+	f.s.state.idempotencyKeys[key.ID] = stored
+	return true, nil
+}
+
+func (f *fakeIdempotencyKeyRepository) Delete(_ context.Context, _ *gorm.DB, key *models.IdempotencyKey) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	if f.held(key) {
+		delete(f.s.state.idempotencyKeys, key.ID)
+	}
+	return nil
+}
+
+func (f *fakeIdempotencyKeyRepository) DeleteExpired(_ context.Context, before time.Time, limit int) (int, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	deleted := 0
+	for id, key := range f.s.state.idempotencyKeys {
+		if deleted < limit && key.ExpiresAt.Before(before) {
+			delete(f.s.state.idempotencyKeys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// fakeGatewayRegistry returns the gateways registered by provider.
+type fakeGatewayRegistry map[constants.PaymentProvider]gateway.IPaymentGateway
+
+func (f fakeGatewayRegistry) Get(provider constants.PaymentProvider) (gateway.IPaymentGateway, error) {
+	paymentGateway, ok := f[provider]
+	if !ok {
+		return nil, errPayment.ErrUnsupportedProvider
+	}
+	return paymentGateway, nil
+}
+
+// fakeGateway is the offline gateway, with hooks that run before its calls
+// and can fail them.
+type fakeGateway struct {
+	*fakeClient.FakeClient
+	onCancel func(orderID string) error
+	onRefund func(orderID string, request *dto.GatewayRefundRequest) error
+	cancels  []string
+	refunds  []dto.GatewayRefundRequest
+}
+
+func newFakeGateway() *fakeGateway {
+	return &fakeGateway{FakeClient: fakeClient.NewFakeClient()}
+}
+
+func (g *fakeGateway) Cancel(orderID string, status constants.PaymentStatus) error {
+	g.cancels = append(g.cancels, orderID)
+	if g.onCancel != nil {
+		err := g.onCancel(orderID)
+		if err != nil {
+			return err
+		}
+	}
+	return g.FakeClient.Cancel(orderID, status)
+}
+
+func (g *fakeGateway) Refund(orderID string, request *dto.GatewayRefundRequest) error {
+	g.refunds = append(g.refunds, *request)
+	if g.onRefund != nil {
+		err := g.onRefund(orderID, request)
+		if err != nil {
+			return err
+		}
+	}
+	return g.FakeClient.Refund(orderID, request)
+}
+
+// fakeKafka records the messages it publishes, or fails them while the
+// broker is down or when reject refuses them.
+type fakeKafka struct {
+	mu       sync.Mutex
+	down     bool
+	reject   func(*kafka.Message) bool
+	messages []kafka.Message
+}
+
+func (f *fakeKafka) GetKafkaProducer() kafka.IKafka {
+	return f
+}
+
+func (f *fakeKafka) ProduceMessage(message *kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.down {
+		return sarama.ErrOutOfBrokers
+	}
+	if f.reject != nil && f.reject(message) {
+		return fmt.Errorf("kafka server: message was too large")
+	}
+	f.messages = append(f.messages, *message)
+	return nil
+}
+
+func (f *fakeKafka) Close() error {
+	return nil
+}
+
+func (f *fakeKafka) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.down = down
+}
+
+// published returns the payloads of the published messages in the order
+// they were published.
+func (f *fakeKafka) published() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payloads := make([]string, 0, len(f.messages))
+	for _, message := range f.messages {
+		payloads = append(payloads, string(message.Value))
+	}
+	return payloads
+}
+
+// fakeGCS stores uploads in memory.
+type fakeGCS struct {
+	mu      sync.Mutex
+	uploads []string
+}
+
+func (f *fakeGCS) UploadFile(_ context.Context, name string, _ []byte) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.uploads = append(f.uploads, name)
+	return "https://storage.test/" + name, nil
+}
+
+// fakeOrderTopic is the order topic whose dead letters are re-driven into
+// HandleOrderEvent.
+const fakeOrderTopic = "order"
+
+// testEnv is a PaymentService and an OutboxService over the fake
+// repositories.
+type testEnv struct {
+	service       *PaymentService
+	outboxService outboxService.IOutboxService
+	store         *fakeStore
+	gcs           *fakeGCS
+	kafka         *fakeKafka
+}
+
+func newTestEnv(t *testing.T, gateways fakeGatewayRegistry) *testEnv {
+	t.Helper()
+
+	// The invoice template is read relative to the repository root.
+	t.Chdir("../..")
+	render := renderPDF
+	renderPDF = func(string, any) ([]byte, error) { return []byte("%PDF"), nil }
+	t.Cleanup(func() { renderPDF = render })
+
+	store := newFakeStore()
+	registry := newFakeRegistry(t, store)
+	gcs := &fakeGCS{}
+	kafka := &fakeKafka{}
+	service := &PaymentService{
+		repository: registry,
+		gcs:        gcs,
+		kafka:      kafka,
+		gateway:    gateways,
+	}
+	return &testEnv{
+		service: service,
+		outboxService: outboxService.NewOutboxService(registry, kafka, map[string]outboxService.EventHandler{
+			fakeOrderTopic: service.HandleOrderEvent,
+		}),
+		store: store,
+		gcs:   gcs,
+		kafka: kafka,
+	}
+}
+
+// addPayment stores a payment of the order with the given status, amount
+// and provider.
+func (e *testEnv) addPayment(status constants.PaymentStatus, amount int64, provider constants.PaymentProvider) models.Payment {
+	e.store.mu.Lock()
+	defer e.store.mu.Unlock()
+
+	now := time.Now()
+	expiredAt := now.Add(time.Hour)
+	description := "order"
+	payment := models.Payment{
+		ID:          e.store.id(),
+		UUID:        uuid.New(),
+		OrderID:     uuid.New(),
+		Money:       money.New(amount, constants.IDR),
+		Status:      &status,
+		Provider:    provider,
+		Description: &description,
+		ExpiredAt:   &expiredAt,
+		CreatedAt:   &now,
+		UpdatedAt:   &now,
+	}
+	if status == constants.Settlement || status == constants.PartialRefund || status == constants.NeedsReview {
+		payment.PaidAt = &now
+	}
+	e.store.state.payments[payment.ID] = payment
+
+	return payment
+}
+
+// updatePayment changes a stored payment in place, as another transaction
+// would.
+func (e *testEnv) updatePayment(id uint, update func(*models.Payment)) {
+	e.store.mu.Lock()
+	defer e.store.mu.Unlock()
+
+	payment := e.store.state.payments[id]
+	update(&payment)
+	e.store.state.payments[id] = payment
+}
+
+// inTransaction reports whether a transaction is open.
+func (e *testEnv) inTransaction() bool {
+	e.store.mu.Lock()
+	defer e.store.mu.Unlock()
+
+	return len(e.store.snapshots) > 0
+}
+
+func (e *testEnv) payment(t *testing.T, orderID uuid.UUID) models.Payment {
+	t.Helper()
+
+	payment, err := e.service.repository.GetPayment().FindByOrderID(context.Background(), orderID.String())
+	if err != nil {
+		t.Fatalf("FindByOrderID() error = %v", err)
+	}
+	return *payment
+}
+
+func (e *testEnv) outbox() []models.Outbox {
+	e.store.mu.Lock()
+	defer e.store.mu.Unlock()
+
+	messages := slices.Collect(maps.Values(e.store.state.outbox))
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages
+}
+
+// updateIdempotencyKeys changes every stored idempotency key in place, as
+// time passing or another request would.
+func (e *testEnv) updateIdempotencyKeys(update func(*models.IdempotencyKey)) {
+	e.store.mu.Lock()
+	defer e.store.mu.Unlock()
+
+	for id, key := range e.store.state.idempotencyKeys {
+		update(&key)
+		e.store.state.idempotencyKeys[id] = key
+	}
+}
+
+func (e *testEnv) idempotencyKeys() []models.IdempotencyKey {
+	e.store.mu.Lock()
+	defer e.store.mu.Unlock()
+
+	return slices.Collect(maps.Values(e.store.state.idempotencyKeys))
+}
+
+func (e *testEnv) deadLetters() []models.DeadLetter {
+	e.store.mu.Lock()
+	defer e.store.mu.Unlock()
+
+	deadLetters := slices.Collect(maps.Values(e.store.state.deadLetters))
+	sort.Slice(deadLetters, func(i, j int) bool { return deadLetters[i].ID < deadLetters[j].ID })
+	return deadLetters
+}
+
+func (e *testEnv) histories(paymentID uint) []models.PaymentHistory {
+	e.store.mu.Lock()
+	defer e.store.mu.Unlock()
+
+	histories := make([]models.PaymentHistory, 0)
+	for _, history := range e.store.state.histories {
+		if history.PaymentID == paymentID {
+			histories = append(histories, history)
+		}
+	}
+	return histories
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	clientUser "payment-service/clients/user"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Create creates the payment of an order. With an idempotency key, a retry
+// of the same request returns the original response instead of creating the
+// payment again; see idempotent.
+func (p *PaymentService) Create(ctx context.Context, request *dto.PaymentRequest) (*dto.PaymentResponse, error) {
+	return p.idempotent(ctx, constants.IdempotencyScopeCreatePayment, request.IdempotencyKey, request, func() (*dto.PaymentResponse, error) {
+		return p.create(ctx, request)
+	})
+}
+
+// idempotent runs do once per idempotency key of the caller within scope. A
+// retry of the same request returns the original response instead of running
+// do again, and a different request with the same key is rejected. Keys are
+// scoped to the authenticated user, so that callers cannot see or block each
+// other's requests, and expire after IdempotencyKeyTTL. A failed request
+// releases its key; a key left processing, e.g. by a crash, is released when
+// its lease runs out. Without a key, do simply runs.
+func (p *PaymentService) idempotent(
+	ctx context.Context,
+	scope string,
+	idempotencyKey string,
+	request any,
+	do func() (*dto.PaymentResponse, error),
+) (*dto.PaymentResponse, error) {
+	if idempotencyKey == "" {
+		return do()
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(hash[:])
+
+	key, created, err := p.repository.GetIdempotencyKey().Create(ctx, p.repository.GetTx(), &dto.IdempotencyKeyRequest{
+		Scope:       scope,
+		Owner:       p.owner(ctx),
+		Key:         idempotencyKey,
+		RequestHash: requestHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !created {
+		if key.RequestHash != requestHash {
+			return nil, errPayment.ErrIdempotencyKeyMismatch
+		}
+		if key.Status != constants.IdempotencyKeyCompleted || key.Response == nil {
+			return nil, errPayment.ErrIdempotencyKeyInProgress
+		}
+
+		var response dto.PaymentResponse
+		err = json.Unmarshal([]byte(*key.Response), &response)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Infof("replayed %s request with idempotency key %s", scope, idempotencyKey)
+		return &response, nil
+	}
+
+	response, err := do()
+	if err != nil {
+		// Release the key so that the client can retry the failed request.
+		deleteErr := p.repository.GetIdempotencyKey().Delete(ctx, p.repository.GetTx(), key)
+		if deleteErr != nil {
+			logrus.Errorf("failed to release idempotency key %s: %v", idempotencyKey, deleteErr)
+		}
+		return nil, err
+	}
+
+	body, err = json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lease is checked by the same statement that completes the key, so
+	// that a request whose lease ran out never overwrites the key of the
+	// request that took it over.
+	completed, err := p.repository.GetIdempotencyKey().Complete(ctx, p.repository.GetTx(), key, body)
+	if err != nil {
+		logrus.Errorf("failed to store the response of idempotency key %s, it is released when its lease runs out: %v", idempotencyKey, err)
+	} else if !completed {
+		logrus.Warnf("lease of idempotency key %s ran out before its response was stored", idempotencyKey)
+	}
+
+	return response, nil
+}
+
+// owner returns the UUID of the authenticated user, whose idempotency keys
+// are kept apart from everyone else's.
+func (p *PaymentService) owner(ctx context.Context) string {
+	user, ok := ctx.Value(constants.User).(*clientUser.UserData)
+	if !ok {
+		return ""
+	}
+	return user.UUID.String()
+}
+
+// purgeIdempotencyKeys deletes the expired idempotency keys in batches and
+// returns how many were deleted.
+func (p *PaymentService) purgeIdempotencyKeys(ctx context.Context) (int, error) {
+	purged := 0
+	now := time.Now()
+	for {
+		deleted, err := p.repository.GetIdempotencyKey().DeleteExpired(ctx, now, p.expiryBatchSize())
+		purged += deleted
+		if err != nil || deleted < p.expiryBatchSize() || ctx.Err() != nil {
+			return purged, err
+		}
+	}
+}
+
+// ensureNewOrder rejects a second payment for the same order before the
+// gateway is called, which would otherwise refuse the reused order ID.
+func (p *PaymentService) ensureNewOrder(ctx context.Context, orderID string) error {
+	_, err := p.repository.GetPayment().FindByOrderID(ctx, orderID)
+	if err == nil {
+		return errPayment.ErrPaymentExists
+	}
+	if errors.Is(err, errPayment.ErrPaymentNotFound) {
+		return nil
+	}
+	return err
+}
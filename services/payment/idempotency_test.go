@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"errors"
+	clientUser "payment-service/clients/user"
+	"payment-service/common/money"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func customerContext() context.Context {
+	return context.WithValue(context.Background(), constants.User, &clientUser.UserData{
+		UUID: uuid.New(),
+		Role: constants.Customer,
+	})
+}
+
+func paymentRequest(idempotencyKey string) *dto.PaymentRequest {
+	description := "order"
+	return &dto.PaymentRequest{
+		OrderID:        uuid.NewString(),
+		ExpiredAt:      time.Now().Add(time.Hour),
+		Money:          money.New(150000, constants.IDR),
+		Description:    &description,
+		CustomerDetail: &dto.CustomerDetail{Name: "Budi"},
+		ItemDetail:     []dto.ItemDetail{{ID: "item", Name: "Item", Amount: 150000, Quantity: 1}},
+		Provider:       constants.FakeProvider,
+		IdempotencyKey: idempotencyKey,
+	}
+}
+
+func TestCreateWithIdempotencyKey(t *testing.T) {
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: newFakeGateway()})
+	ctx := customerContext()
+	request := paymentRequest("key")
+
+	created, err := env.service.Create(ctx, request)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	replayed, err := env.service.Create(ctx, request)
+	if err != nil || replayed.UUID != created.UUID {
+		t.Fatalf("Create() retry = %v, %v, want the payment %s", replayed, err, created.UUID)
+	}
+
+	_, err = env.service.Create(ctx, paymentRequest("key"))
+	if !errors.Is(err, errPayment.ErrIdempotencyKeyMismatch) {
+		t.Errorf("Create() of another order with the same key error = %v, want %v", err, errPayment.ErrIdempotencyKeyMismatch)
+	}
+
+	// The keys of one customer are not seen by another.
+	other, err := env.service.Create(customerContext(), paymentRequest("key"))
+	if err != nil || other.UUID == created.UUID {
+		t.Errorf("Create() by another customer = %v, %v, want a new payment", other, err)
+	}
+}
+
+func TestChargeWithIdempotencyKey(t *testing.T) {
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: newFakeGateway()})
+	ctx := customerContext()
+	request := &dto.ChargeRequest{PaymentRequest: *paymentRequest("key"), PaymentMethod: constants.BCAVirtualAccount}
+
+	charged, err := env.service.Charge(ctx, request)
+	if err != nil {
+		t.Fatalf("Charge() error = %v", err)
+	}
+
+	replayed, err := env.service.Charge(ctx, request)
+	if err != nil || replayed.UUID != charged.UUID {
+		t.Fatalf("Charge() retry = %v, %v, want the payment %s", replayed, err, charged.UUID)
+	}
+
+	// The key is scoped to the endpoint.
+	_, err = env.service.Create(ctx, paymentRequest("key"))
+	if err != nil {
+		t.Errorf("Create() with the key of a charge error = %v", err)
+	}
+}
+
+func TestIdempotentKeyLease(t *testing.T) {
+	env := newTestEnv(t, fakeGatewayRegistry{})
+	ctx := customerContext()
+	request := map[string]string{"order": "1"}
+	first := &dto.PaymentResponse{UUID: uuid.New()}
+	second := &dto.PaymentResponse{UUID: uuid.New()}
+
+	// The first request runs past its lease; its retry takes the key over
+	// and completes before the first request finishes.
+	response, err := env.service.idempotent(ctx, constants.IdempotencyScopeCreatePayment, "key", request, func() (*dto.PaymentResponse, error) {
+		_, err := env.service.idempotent(ctx, constants.IdempotencyScopeCreatePayment, "key", request, func() (*dto.PaymentResponse, error) {
+			t.Fatal("retry ran while the key was leased")
+			return nil, nil
+		})
+		if !errors.Is(err, errPayment.ErrIdempotencyKeyInProgress) {
+			t.Errorf("idempotent() while leased error = %v, want %v", err, errPayment.ErrIdempotencyKeyInProgress)
+		}
+
+		env.updateIdempotencyKeys(func(key *models.IdempotencyKey) {
+			lockedUntil := time.Now().Add(-time.Second)
+			key.LockedUntil = &lockedUntil
+		})
+		return env.service.idempotent(ctx, constants.IdempotencyScopeCreatePayment, "key", request, func() (*dto.PaymentResponse, error) {
+			return second, nil
+		})
+	})
+	if err != nil || response.UUID != second.UUID {
+		t.Fatalf("idempotent() = %v, %v, want the response of the retry", response, err)
+	}
+
+	replayed, err := env.service.idempotent(ctx, constants.IdempotencyScopeCreatePayment, "key", request, func() (*dto.PaymentResponse, error) {
+		return first, nil
+	})
+	if err != nil || replayed.UUID != second.UUID {
+		t.Errorf("idempotent() replay = %v, %v, want the response stored by the lease holder", replayed, err)
+	}
+}
+
+func TestIdempotentFailureReleasesOnlyItsOwnLease(t *testing.T) {
+	env := newTestEnv(t, fakeGatewayRegistry{})
+	ctx := customerContext()
+	request := map[string]string{"order": "1"}
+	failure := errors.New("gateway unavailable")
+
+	_, err := env.service.idempotent(ctx, constants.IdempotencyScopeCreatePayment, "key", request, func() (*dto.PaymentResponse, error) {
+		return nil, failure
+	})
+	if !errors.Is(err, failure) || len(env.idempotencyKeys()) != 0 {
+		t.Fatalf("idempotent() = %v with keys %v, want the failed request to release its key", err, env.idempotencyKeys())
+	}
+
+	// A failing request whose lease was taken over leaves the key of the
+	// request that took it over alone.
+	_, err = env.service.idempotent(ctx, constants.IdempotencyScopeCreatePayment, "key", request, func() (*dto.PaymentResponse, error) {
+		env.updateIdempotencyKeys(func(key *models.IdempotencyKey) {
+			key.Lease = uuid.New()
+		})
+		return nil, failure
+	})
+	if !errors.Is(err, failure) || len(env.idempotencyKeys()) != 1 {
+		t.Errorf("idempotent() = %v with keys %v, want the taken over key kept", err, env.idempotencyKeys())
+	}
+}
+
+func TestIdempotencyKeyExpiry(t *testing.T) {
+	env := newTestEnv(t, fakeGatewayRegistry{})
+	ctx := customerContext()
+	respond := func() (*dto.PaymentResponse, error) {
+		return &dto.PaymentResponse{UUID: uuid.New()}, nil
+	}
+
+	_, err := env.service.idempotent(ctx, constants.IdempotencyScopeCreatePayment, "expired", "first", respond)
+	if err != nil {
+		t.Fatalf("idempotent() error = %v", err)
+	}
+	env.updateIdempotencyKeys(func(key *models.IdempotencyKey) {
+		expiresAt := time.Now().Add(-time.Second)
+		key.ExpiresAt = &expiresAt
+	})
+
+	// An expired key is free for a new request.
+	_, err = env.service.idempotent(ctx, constants.IdempotencyScopeCreatePayment, "expired", "second", respond)
+	if err != nil {
+		t.Fatalf("idempotent() with an expired key error = %v", err)
+	}
+	_, err = env.service.idempotent(ctx, constants.IdempotencyScopeCreatePayment, "fresh", "first", respond)
+	if err != nil {
+		t.Fatalf("idempotent() error = %v", err)
+	}
+	env.updateIdempotencyKeys(func(key *models.IdempotencyKey) {
+		if key.Key == "expired" {
+			expiresAt := time.Now().Add(-time.Second)
+			key.ExpiresAt = &expiresAt
+		}
+	})
+
+	purged, err := env.service.purgeIdempotencyKeys(context.Background())
+	if err != nil || purged != 1 {
+		t.Fatalf("purgeIdempotencyKeys() = %d, %v, want 1, nil", purged, err)
+	}
+	if keys := env.idempotencyKeys(); len(keys) != 1 || keys[0].Key != "fresh" {
+		t.Errorf("idempotency keys = %v, want only the fresh one", keys)
+	}
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"payment-service/config"
+	"payment-service/constants"
+	errConstant "payment-service/constants/error"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/controllers/kafka"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// withMaxAttempts dead-letters outbox messages after maxAttempts failures.
+func withMaxAttempts(t *testing.T, maxAttempts int) {
+	t.Helper()
+
+	outbox := config.Config.Outbox
+	config.Config.Outbox.MaxAttempts = maxAttempts
+	t.Cleanup(func() { config.Config.Outbox = outbox })
+}
+
+// addOutbox writes an outbox message with the given key, whose payload is
+// its name.
+func (e *testEnv) addOutbox(t *testing.T, key string, name string) {
+	t.Helper()
+
+	payload, _ := json.Marshal(name)
+	err := e.service.repository.GetOutbox().Create(context.Background(), nil, &dto.OutboxRequest{
+		Topic:   "payment",
+		Key:     key,
+		Payload: payload,
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+}
+
+func (e *testEnv) relay(t *testing.T) {
+	t.Helper()
+
+	_, err := e.outboxService.Relay(context.Background())
+	if err != nil {
+		t.Fatalf("Relay() error = %v", err)
+	}
+}
+
+func rejectPayload(name string) func(*kafka.Message) bool {
+	return func(message *kafka.Message) bool {
+		return string(message.Value) == `"`+name+`"`
+	}
+}
+
+func TestRelayDeadLetterHoldsBackItsKeyUntilRedriven(t *testing.T) {
+	withMaxAttempts(t, 1)
+	env := newTestEnv(t, fakeGatewayRegistry{})
+	env.addOutbox(t, "a", "a1")
+	env.addOutbox(t, "a", "a2")
+	env.addOutbox(t, "b", "b1")
+
+	env.kafka.reject = rejectPayload("a1")
+	env.relay(t)
+	env.relay(t)
+
+	if got := env.kafka.published(); !slices.Equal(got, []string{`"b1"`}) {
+		t.Fatalf("published = %v, want only b1 while a1 is dead", got)
+	}
+	deadLetters := env.deadLetters()
+	if len(deadLetters) != 1 || deadLetters[0].Payload != `"a1"` {
+		t.Fatalf("dead letters = %v, want a1", deadLetters)
+	}
+
+	env.kafka.reject = nil
+	redriven, err := env.outboxService.RedriveDeadLetters(context.Background(), &dto.DeadLetterRequestParam{})
+	if err != nil || redriven != 1 {
+		t.Fatalf("RedriveDeadLetters() = %d, %v, want 1, nil", redriven, err)
+	}
+	env.relay(t)
+
+	if got := env.kafka.published(); !slices.Equal(got, []string{`"b1"`, `"a1"`, `"a2"`}) {
+		t.Errorf("published = %v, want a1 before a2", got)
+	}
+	if got := len(env.outbox()); got != 3 {
+		t.Errorf("outbox has %d messages, want the re-driven message in its original row", got)
+	}
+
+	// Re-driving the same dead letter again, e.g. from the dead-letter topic,
+	// publishes nothing twice.
+	err = env.outboxService.Redrive(context.Background(), &dto.DeadLetterMessage{
+		ID:       deadLetters[0].UUID,
+		OutboxID: deadLetters[0].OutboxID,
+		Topic:    deadLetters[0].Topic,
+		Payload:  json.RawMessage(deadLetters[0].Payload),
+	})
+	if err != nil {
+		t.Fatalf("Redrive() error = %v", err)
+	}
+	env.relay(t)
+	if got := len(env.kafka.published()); got != 3 {
+		t.Errorf("published %d messages, want 3", got)
+	}
+}
+
+func TestRelayDiscardReleasesTheKey(t *testing.T) {
+	withMaxAttempts(t, 1)
+	env := newTestEnv(t, fakeGatewayRegistry{})
+	env.addOutbox(t, "a", "a1")
+	env.addOutbox(t, "a", "a2")
+
+	env.kafka.reject = rejectPayload("a1")
+	env.relay(t)
+
+	dead := env.outbox()[0]
+	err := env.outboxService.Discard(context.Background(), dead.ID)
+	if err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+	env.relay(t)
+
+	if got := env.kafka.published(); !slices.Equal(got, []string{`"a2"`}) {
+		t.Errorf("published = %v, want a2 once a1 is discarded", got)
+	}
+	if !errors.Is(env.outboxService.Discard(context.Background(), dead.ID), errPayment.ErrDeadLetterNotFound) {
+		t.Errorf("Discard() of a discarded message, want %v", errPayment.ErrDeadLetterNotFound)
+	}
+
+	redriven, err := env.outboxService.RedriveDeadLetters(context.Background(), &dto.DeadLetterRequestParam{})
+	if err != nil || redriven != 0 {
+		t.Errorf("RedriveDeadLetters() = %d, %v, want the discarded dead letter skipped", redriven, err)
+	}
+}
+
+func TestRelayBrokerOutageCountsNoAttempts(t *testing.T) {
+	withMaxAttempts(t, 1)
+	env := newTestEnv(t, fakeGatewayRegistry{})
+	env.addOutbox(t, "a", "a1")
+	env.addOutbox(t, "a", "a2")
+	env.addOutbox(t, "b", "b1")
+
+	// Kafka is called outside the claiming transaction.
+	env.kafka.reject = func(*kafka.Message) bool {
+		if env.inTransaction() {
+			t.Errorf("message produced inside a transaction")
+		}
+		return false
+	}
+
+	// An outage of any length dead-letters nothing.
+	env.kafka.setDown(true)
+	for range 20 {
+		sent, err := env.outboxService.Relay(context.Background())
+		if !errors.Is(err, errConstant.ErrBrokerUnavailable) || sent != 0 {
+			t.Fatalf("Relay() = %d, %v, want 0, %v", sent, err, errConstant.ErrBrokerUnavailable)
+		}
+	}
+
+	for _, outbox := range env.outbox() {
+		if outbox.Status != constants.OutboxPending || outbox.Attempts != 0 || outbox.ClaimID != nil {
+			t.Errorf("outbox %s = %s after %d attempts, want it pending with no attempt counted",
+				outbox.Payload, outbox.Status, outbox.Attempts)
+		}
+	}
+	if got := env.outbox()[0].LastError; got == nil {
+		t.Errorf("last error of the first message = nil, want the outage recorded")
+	}
+	if got := env.deadLetters(); len(got) != 0 {
+		t.Errorf("dead letters = %v, want none during an outage", got)
+	}
+
+	env.kafka.setDown(false)
+	env.relay(t)
+	if got := env.kafka.published(); !slices.Equal(got, []string{`"a1"`, `"a2"`, `"b1"`}) {
+		t.Errorf("published = %v, want every message in order once the broker is back", got)
+	}
+}
+
+func orderCancelledEvent(t *testing.T, orderID uuid.UUID) json.RawMessage {
+	t.Helper()
+
+	payload, err := json.Marshal(dto.OrderEvent{
+		Event: dto.KafkaEvent{Name: constants.OrderCancelledEvent},
+		Body:  dto.OrderEventBody{Data: &dto.OrderEventData{OrderID: orderID}},
+	})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	return payload
+}
+
+func TestHandleOrderEventCancelsThePayment(t *testing.T) {
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: newFakeGateway()})
+	payment := env.addPayment(constants.Pending, 150000, constants.FakeProvider)
+	settled := env.addPayment(constants.Settlement, 150000, constants.FakeProvider)
+
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{name: "cancelled", payload: orderCancelledEvent(t, payment.OrderID)},
+		{name: "cancelled again", payload: orderCancelledEvent(t, payment.OrderID)},
+		{name: "already paid", payload: orderCancelledEvent(t, settled.OrderID)},
+		{name: "unknown order", payload: orderCancelledEvent(t, uuid.New())},
+		{name: "other event", payload: []byte(`{"event": {"name": "CREATED"}}`)},
+		{name: "malformed", payload: []byte(`{`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := env.service.HandleOrderEvent(context.Background(), tt.payload)
+			if err != nil {
+				t.Fatalf("HandleOrderEvent() error = %v", err)
+			}
+		})
+	}
+
+	if got := env.payment(t, payment.OrderID); *got.Status != constants.Cancel {
+		t.Errorf("payment = %s, want cancel", got.Status.GetStatusString())
+	}
+	if got := env.payment(t, settled.OrderID); *got.Status != constants.Settlement {
+		t.Errorf("settled payment = %s, want settlement", got.Status.GetStatusString())
+	}
+	if got := len(env.outbox()); got != 1 {
+		t.Errorf("outbox has %d messages, want the one cancellation", got)
+	}
+}
+
+func TestRedriveConsumedDeadLetterIntoItsHandler(t *testing.T) {
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: newFakeGateway()})
+	payment := env.addPayment(constants.Pending, 150000, constants.FakeProvider)
+
+	for _, message := range []*dto.DeadLetterMessage{
+		{ID: uuid.New(), Topic: fakeOrderTopic, Key: payment.OrderID.String(), Payload: orderCancelledEvent(t, payment.OrderID)},
+		{ID: uuid.New(), Topic: "inventory", Payload: json.RawMessage(`{}`)},
+	} {
+		err := env.outboxService.DeadLetter(context.Background(), message)
+		if err != nil {
+			t.Fatalf("DeadLetter() error = %v", err)
+		}
+	}
+
+	redriven, err := env.outboxService.RedriveDeadLetters(context.Background(), &dto.DeadLetterRequestParam{})
+	if !errors.Is(err, errPayment.ErrUnknownDeadLetterTopic) || redriven != 1 {
+		t.Fatalf("RedriveDeadLetters() = %d, %v, want 1, %v", redriven, err, errPayment.ErrUnknownDeadLetterTopic)
+	}
+
+	if got := env.payment(t, payment.OrderID); *got.Status != constants.Cancel {
+		t.Errorf("payment = %s, want cancel", got.Status.GetStatusString())
+	}
+	if slices.ContainsFunc(env.outbox(), func(outbox models.Outbox) bool { return outbox.Topic == fakeOrderTopic }) {
+		t.Errorf("outbox = %v, want nothing republished to the order topic", env.outbox())
+	}
+
+	remaining, err := env.outboxService.RedriveDeadLetters(context.Background(), &dto.DeadLetterRequestParam{})
+	if !errors.Is(err, errPayment.ErrUnknownDeadLetterTopic) || remaining != 0 {
+		t.Errorf("RedriveDeadLetters() = %d, %v, want the unknown topic left stored", remaining, err)
+	}
+}
@@ -5,14 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"math/rand"
 	"os"
-	client "payment-service/clients/midtrans"
+	"payment-service/clients/gateway"
+	clientUser "payment-service/clients/user"
 	"payment-service/common/gcs"
+	"payment-service/common/money"
 	"payment-service/common/util"
-	"payment-service/config"
 	"payment-service/constants"
+	errConstant "payment-service/constants/error"
 	errPayment "payment-service/constants/error/payment"
 	"payment-service/controllers/kafka"
 	"payment-service/domain/dto"
@@ -21,6 +22,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
@@ -28,55 +31,74 @@ type PaymentService struct {
 	repository repositories.IRepositoryRegistry
 	gcs        gcs.IGCSlient
 	kafka      kafka.IKafkaRegistry
-	midtrans   client.IMidtransClient
+	gateway    gateway.IGatewayRegistry
 }
 
 type IPaymentService interface {
 	GetAllWithPagination(context.Context, *dto.PaymentRequestParam) (*util.PaginationResult, error)
+	GetAllWithCursor(context.Context, *dto.PaymentRequestParam) (*util.CursorPaginationResult, error)
 	GetByUUID(context.Context, string) (*dto.PaymentResponse, error)
 	Create(context.Context, *dto.PaymentRequest) (*dto.PaymentResponse, error)
-	WebHook(context.Context, *dto.WebHook) error
+	Charge(context.Context, *dto.ChargeRequest) (*dto.PaymentResponse, error)
+	WebHook(context.Context, constants.PaymentProvider, []byte) error
+	ReplayWebHook(context.Context, string) (*dto.WebhookEventResponse, error)
+	ReplayWebHooks(context.Context, *dto.WebhookEventRequestParam) ([]dto.WebhookEventResponse, error)
+	CancelByOrderID(context.Context, string) error
+	HandleOrderEvent(context.Context, []byte) error
+	Cancel(context.Context, string) (*dto.PaymentResponse, error)
+	Refund(context.Context, string, *dto.CreateRefundRequest) (*dto.RefundResponse, error)
+	Simulate(context.Context, string, *dto.SimulatePaymentRequest) (*dto.PaymentResponse, error)
+	Reconcile(context.Context) (*dto.ReconcileReport, error)
+	RunReconciler(context.Context)
+	ExpireOverdue(context.Context) (int, error)
+	RunExpirySweeper(context.Context)
 }
 
-func NewPaymentService(repository repositories.IRepositoryRegistry, gcs gcs.IGCSlient, kafka kafka.IKafkaRegistry, midtrans client.IMidtransClient) IPaymentService {
+func NewPaymentService(repository repositories.IRepositoryRegistry, gcs gcs.IGCSlient, kafka kafka.IKafkaRegistry, gateway gateway.IGatewayRegistry) IPaymentService {
 	return &PaymentService{
 		repository: repository,
 		gcs:        gcs,
 		kafka:      kafka,
-		midtrans:   midtrans,
+		gateway:    gateway,
 	}
 }
 
 func (p *PaymentService) GetAllWithPagination(ctx context.Context, param *dto.PaymentRequestParam) (*util.PaginationResult, error) {
-	payment, total, err := p.repository.GetPayment().FindAllWithPagination(ctx, param)
+	err := p.validateFilters(param)
 	if err != nil {
 		return nil, err
 	}
 
-	paymentResult := make([]dto.PaymentResponse, 0, len(payment))
-	for _, payment := range payment {
-		paymentResult = append(paymentResult, dto.PaymentResponse{
-			UUID:          payment.UUID,
-			TransactionID: payment.TransactionID,
-			OrderID:       payment.OrderID,
-			Amount:        payment.Amount,
-			Status:        payment.Status.GetStatusString(),
-			PaymentLink:   payment.PaymentLink,
-			InvoiceLink:   payment.InvoiceLink,
-			VANumber:      payment.VANumber,
-			Bank:          payment.Bank,
-			Description:   payment.Description,
-			ExpiredAt:     payment.ExpiredAt,
-			CreatedAt:     payment.CreatedAt,
-			UpdatedAt:     payment.UpdatedAt,
-		})
+	param.SortFields, err = p.parseSort(param)
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := p.repository.GetPayment().FindAllWithPagination(ctx, param)
+	if err != nil {
+		return nil, err
+	}
+
+	hasNext := len(payment) > param.Limit
+	if hasNext {
+		payment = payment[:param.Limit]
+	}
+
+	var total *int64
+	if param.WithCount == nil || *param.WithCount {
+		count, err := p.repository.GetPayment().Count(ctx, param)
+		if err != nil {
+			return nil, err
+		}
+		total = &count
 	}
 
 	paginationParam := util.PaginationParams{
-		Page:  param.Page,
-		Limit: param.Limit,
-		Count: total,
-		Data:  paymentResult,
+		Page:    param.Page,
+		Limit:   param.Limit,
+		Count:   total,
+		HasNext: hasNext,
+		Data:    p.toPaymentResponses(payment),
 	}
 
 	response := util.GeneratePagination(paginationParam)
@@ -85,151 +107,283 @@ func (p *PaymentService) GetAllWithPagination(ctx context.Context, param *dto.Pa
 }
 
 func (p *PaymentService) GetByUUID(ctx context.Context, uuid string) (*dto.PaymentResponse, error) {
-	log.Println("Fetching payment by UUID:", uuid)
 	payment, err := p.repository.GetPayment().FindByUUID(ctx, uuid)
 	if err != nil {
 		return nil, err
 	}
 
+	return p.toPaymentResponse(payment), nil
+}
+
+func (p *PaymentService) toPaymentResponse(payment *models.Payment) *dto.PaymentResponse {
 	return &dto.PaymentResponse{
 		UUID:          payment.UUID,
 		TransactionID: payment.TransactionID,
 		OrderID:       payment.OrderID,
-		Amount:        payment.Amount,
+		Money:         payment.Money,
 		Status:        payment.Status.GetStatusString(),
+		Provider:      payment.Provider,
+		CustomerID:    payment.CustomerID,
 		PaymentLink:   payment.PaymentLink,
 		InvoiceLink:   payment.InvoiceLink,
 		VANumber:      payment.VANumber,
 		Bank:          payment.Bank,
+		PaymentMethod: payment.PaymentMethod,
+		BillerCode:    payment.BillerCode,
+		QRString:      payment.QRString,
+		Deeplink:      payment.Deeplink,
 		Description:   payment.Description,
 		ExpiredAt:     payment.ExpiredAt,
 		CreatedAt:     payment.CreatedAt,
 		UpdatedAt:     payment.UpdatedAt,
-	}, nil
+	}
+}
+
+func (p *PaymentService) toPaymentResponses(payments []models.Payment) []dto.PaymentResponse {
+	responses := make([]dto.PaymentResponse, 0, len(payments))
+	for i := range payments {
+		responses = append(responses, *p.toPaymentResponse(&payments[i]))
+	}
+
+	return responses
 }
 
-func (p *PaymentService) Create(ctx context.Context, request *dto.PaymentRequest) (*dto.PaymentResponse, error) {
+func (p *PaymentService) create(ctx context.Context, request *dto.PaymentRequest) (*dto.PaymentResponse, error) {
 	var (
 		txErr, err error
 		payment    *models.Payment // Deklarasi di luar transaction
 		response   *dto.PaymentResponse
-		midtrans   *client.MidtransData
+		link       *dto.PaymentLinkResponse
 	)
 
-	// ...existing debug code...
-
 	err = p.repository.GetTx().Transaction(func(tx *gorm.DB) error {
 		if !request.ExpiredAt.After(time.Now()) {
-			fmt.Printf("ERROR: ExpiredAt validation failed!\n")
-			fmt.Printf("Validation ExpiredAt: %v\n", request.ExpiredAt)
-			fmt.Printf("Validation time.Now(): %v\n", time.Now())
-			fmt.Printf("Validation result: %v\n", request.ExpiredAt.After(time.Now()))
 			return errPayment.ErrExpiredAtInvalid
 		}
 
-		fmt.Printf("ExpiredAt validation passed, proceeding to create payment link...\n")
-
-		// Pre-Midtrans validation
-		fmt.Printf("=== PRE-MIDTRANS VALIDATION ===\n")
-		if p.midtrans == nil {
-			fmt.Printf("FATAL ERROR: Midtrans client is NIL!\n")
-			return fmt.Errorf("midtrans client not initialized")
+		txErr = p.ensureNewOrder(ctx, request.OrderID)
+		if txErr != nil {
+			return txErr
 		}
-		fmt.Printf("Midtrans client OK: %p\n", p.midtrans)
 
-		// Validate request components before sending to Midtrans
-		if request.CustomerDetail == nil {
-			fmt.Printf("ERROR: CustomerDetail is NIL!\n")
-			return fmt.Errorf("customer detail is required")
+		// Pre-gateway validation
+		paymentGateway, err := p.gateway.Get(request.Provider)
+		if err != nil {
+			return err
 		}
 
-		if len(request.ItemDetail) == 0 {
-			fmt.Printf("ERROR: ItemDetail is EMPTY!\n")
-			return fmt.Errorf("item detail is required")
+		// Validate request components before sending to the gateway
+		txErr = p.validatePaymentRequest(request)
+		if txErr != nil {
+			return txErr
 		}
 
-		fmt.Printf("Pre-validation passed, calling Midtrans...\n")
-
-		// Call Midtrans with detailed error catching
-		fmt.Printf("About to call p.midtrans.CreatePaymentLink(request)...\n")
-		midtrans, txErr = p.midtrans.CreatePaymentLink(request)
+		// Call the payment gateway with detailed error catching
+		link, txErr = paymentGateway.CreatePaymentLink(request)
 
 		if txErr != nil {
-			fmt.Printf("ERROR: Failed to create payment link: %v\n", txErr)
-			fmt.Printf("ERROR Type: %T\n", txErr)
-			fmt.Printf("ERROR String: %s\n", txErr.Error())
 			return txErr
 		}
 
-		if midtrans == nil {
-			fmt.Printf("ERROR: Midtrans response is NIL!\n")
-			return fmt.Errorf("midtrans response is nil")
+		if link == nil {
+			return fmt.Errorf("payment gateway response is nil")
 		}
 
-		fmt.Printf("Payment link created successfully: %s\n", midtrans.RedirectURL)
-		fmt.Printf("Midtrans Token: %s\n", midtrans.Token)
+		logrus.Debugf("payment link created by %s", paymentGateway.Provider())
 
 		paymentRequest := &dto.PaymentRequest{
 			OrderID:     request.OrderID,
-			Amount:      request.Amount,
+			Money:       request.Money,
 			Description: request.Description,
 			ExpiredAt:   request.ExpiredAt,
-			PaymentLink: midtrans.RedirectURL,
+			PaymentLink: link.RedirectURL,
+			Provider:    paymentGateway.Provider(),
+			CustomerID:  p.customerID(ctx),
 		}
 
-		fmt.Printf("Creating payment in database...\n")
-		fmt.Printf("PaymentRequest for DB: %+v\n", paymentRequest)
-
 		// UBAH: Hapus deklarasi variabel baru, gunakan yang sudah ada
 		payment, txErr = p.repository.GetPayment().Create(ctx, tx, paymentRequest)
 		if txErr != nil {
-			fmt.Printf("ERROR: Failed to create payment in database: %v\n", txErr)
 			return txErr
 		}
 
 		if payment == nil {
-			fmt.Printf("ERROR: Payment created but response is NIL!\n")
 			return fmt.Errorf("payment creation returned nil")
 		}
 
-		fmt.Printf("Payment created successfully with UUID: %s\n", payment.UUID)
-
 		txErr = p.repository.GetPaymentHistory().Create(ctx, tx, &dto.PaymentHistoryRequest{
 			PaymentID: payment.ID,
 			Status:    payment.Status.GetStatusString(),
 		})
 		if txErr != nil {
-			fmt.Printf("ERROR: Failed to create payment history: %v\n", txErr)
 			return txErr
 		}
 
-		fmt.Printf("Payment history created successfully\n")
 		return nil
 	})
 
 	if err != nil {
-		fmt.Printf("ERROR: Transaction failed: %v\n", err)
 		return nil, err
 	}
 
 	if payment == nil {
-		fmt.Printf("ERROR: Payment is NIL after transaction!\n")
 		return nil, fmt.Errorf("payment is nil after transaction")
 	}
 
 	response = &dto.PaymentResponse{
 		UUID:        payment.UUID,
 		OrderID:     payment.OrderID,
-		Amount:      payment.Amount,
+		Money:       payment.Money,
 		Status:      payment.Status.GetStatusString(),
+		Provider:    payment.Provider,
 		PaymentLink: payment.PaymentLink,
 		Description: payment.Description,
 	}
 
-	fmt.Printf("Payment creation completed successfully. UUID: %s\n", payment.UUID)
 	return response, nil
 }
 
+// CancelByOrderID cancels the payment of a cancelled order at Midtrans and
+// locally. Payments that can no longer be cancelled, e.g. settled ones, are
+// left untouched.
+func (p *PaymentService) CancelByOrderID(ctx context.Context, orderID string) error {
+	err := p.cancelPayment(ctx, orderID, "order cancelled")
+	if errors.Is(err, errPayment.ErrPaymentAlreadyPaid) || errors.Is(err, errPayment.ErrCancelNotAllowed) {
+		logrus.Warnf("order %s cancelled but its payment cannot be cancelled: %v", orderID, err)
+		return nil
+	}
+
+	return err
+}
+
+// HandleOrderEvent handles an event consumed from the order topic and cancels
+// the payment of a cancelled order. Events that can never be handled, e.g.
+// malformed ones or ones for an order without a payment, are logged and
+// skipped. Handling an event twice is harmless.
+func (p *PaymentService) HandleOrderEvent(ctx context.Context, payload []byte) error {
+	var event dto.OrderEvent
+	err := json.Unmarshal(payload, &event)
+	if err != nil {
+		logrus.Errorf("skipping malformed order event: %v", err)
+		return nil
+	}
+
+	if event.Event.Name != constants.OrderCancelledEvent {
+		return nil
+	}
+
+	if event.Body.Data == nil {
+		logrus.Errorf("skipping order cancelled event without data")
+		return nil
+	}
+
+	orderID := event.Body.Data.OrderID.String()
+	err = p.CancelByOrderID(ctx, orderID)
+	if errors.Is(err, errPayment.ErrPaymentNotFound) {
+		logrus.Warnf("skipping order cancelled event for order %s: %v", orderID, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("handled order cancelled event for order %s", orderID)
+	return nil
+}
+
+// Cancel cancels a payment on behalf of the authenticated user, who must be
+// an admin or the customer who created it. Payments created before customer
+// IDs were recorded, or created by a service rather than a customer, have no
+// owner and can only be cancelled by an admin: nothing on them identifies
+// the customer, so they cannot be backfilled.
+func (p *PaymentService) Cancel(ctx context.Context, uuid string) (*dto.PaymentResponse, error) {
+	payment, err := p.repository.GetPayment().FindByUUID(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := ctx.Value(constants.User).(*clientUser.UserData)
+	if !ok {
+		return nil, errConstant.ErrUnauthorized
+	}
+	if user.Role != constants.Admin && (payment.CustomerID == nil || *payment.CustomerID != user.UUID) {
+		return nil, errConstant.ErrForbidden
+	}
+
+	err = p.cancelPayment(ctx, payment.OrderID.String(), fmt.Sprintf("cancelled by %s %s", user.Role, user.UUID))
+	if err != nil {
+		return nil, err
+	}
+
+	return p.GetByUUID(ctx, uuid)
+}
+
+// cancelPayment cancels the payment of the order at its gateway, then
+// locally, recording note in its history.
+func (p *PaymentService) cancelPayment(ctx context.Context, orderID string, note string) error {
+	return p.repository.GetTx().Transaction(func(tx *gorm.DB) error {
+		payment, err := p.repository.GetPayment().FindByOrderIDForUpdate(ctx, tx, orderID)
+		if err != nil {
+			return err
+		}
+
+		// A payment held for review was paid, so the gateway no longer lets
+		// it be cancelled; it is resolved by refunding it instead.
+		currentStatus := *payment.Status
+		if currentStatus == constants.NeedsReview {
+			return errPayment.ErrPaymentAlreadyPaid
+		}
+		if !currentStatus.CanTransitionTo(constants.Cancel) {
+			if payment.PaidAt != nil {
+				return errPayment.ErrPaymentAlreadyPaid
+			}
+			return errPayment.ErrCancelNotAllowed
+		}
+
+		paymentGateway, err := p.gateway.Get(payment.Provider)
+		if err != nil {
+			return err
+		}
+
+		err = paymentGateway.Cancel(orderID, currentStatus)
+		if errors.Is(err, errPayment.ErrGatewayTransactionNotFound) {
+			logrus.Warnf("order %s has no transaction at %s yet, cancelling locally only", orderID, payment.Provider)
+		} else if err != nil {
+			return err
+		}
+
+		status := constants.Cancel
+		_, err = p.repository.GetPayment().Update(ctx, tx, orderID, &dto.UpdatePaymentRequest{
+			Status: &status,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = p.repository.GetPaymentHistory().Create(ctx, tx, &dto.PaymentHistoryRequest{
+			PaymentID: payment.ID,
+			Status:    constants.CancelString,
+			Note:      &note,
+		})
+		if err != nil {
+			return err
+		}
+
+		payment.Status = &status
+		return p.produceToOutbox(ctx, tx, constants.CancelString, payment)
+	})
+}
+
+// customerID returns the UUID of the authenticated customer, if any, so that
+// the payments they create can later be cancelled by them.
+func (p *PaymentService) customerID(ctx context.Context) *uuid.UUID {
+	user, ok := ctx.Value(constants.User).(*clientUser.UserData)
+	if !ok || user.Role != constants.Customer {
+		return nil
+	}
+	return &user.UUID
+}
+
 func (p *PaymentService) ConvertToIndonesianMonth(englishMonth string) string {
 	monthMap := map[string]string{
 		"January":   "Januari",
@@ -254,6 +408,10 @@ func (p *PaymentService) ConvertToIndonesianMonth(englishMonth string) string {
 	return indonesianMounth
 }
 
+// renderPDF renders an HTML template to a PDF. Tests replace it, since
+// wkhtmltopdf is not installed where they run.
+var renderPDF = util.GeneratePDFfromHTML
+
 func (p *PaymentService) GeneratePDF(req *dto.InvoiceRequest) ([]byte, error) {
 	htmlTemplatePath := "template/invoice.html"
 	htmlTemplate, err := os.ReadFile(htmlTemplatePath)
@@ -268,7 +426,7 @@ func (p *PaymentService) GeneratePDF(req *dto.InvoiceRequest) ([]byte, error) {
 		return nil, err
 	}
 
-	pdf, err := util.GeneratePDFfromHTML(string(htmlTemplate), data)
+	pdf, err := renderPDF(string(htmlTemplate), data)
 	if err != nil {
 		return nil, err
 	}
@@ -293,121 +451,431 @@ func (p *PaymentService) randomNumber() int {
 	return number
 }
 
-func (p *PaymentService) mapTransactionStatusToEvent(status constants.PaymentStatusString) string {
-	var paymentStatus string
-	switch status {
-	case constants.PendingString:
-		paymentStatus = strings.ToUpper(string(constants.PendingString.String()))
-	case constants.SettlementString:
-		paymentStatus = strings.ToUpper(string(constants.SettlementString.String()))
-	case constants.ExpireString:
-		paymentStatus = strings.ToUpper(string(constants.ExpireString.String()))
-	default:
-		paymentStatus = "UNKNOWN STATUS"
+// parseSort translates sort, or the legacy sort_column and sort_order, into
+// whitelisted columns. Unknown and repeated fields are rejected.
+func (p *PaymentService) parseSort(param *dto.PaymentRequestParam) ([]dto.SortField, error) {
+	var sort string
+	switch {
+	case param.Sort != nil:
+		sort = *param.Sort
+	case param.SortColumn != nil:
+		sort = *param.SortColumn
+		if param.SortOrder != nil && strings.EqualFold(*param.SortOrder, "desc") {
+			sort = "-" + sort
+		}
+	}
+	if strings.TrimSpace(sort) == "" {
+		return nil, nil
+	}
+
+	fields := make([]dto.SortField, 0)
+	seen := make(map[string]bool)
+	for _, value := range strings.Split(sort, ",") {
+		value = strings.TrimSpace(value)
+		name, desc := strings.CutPrefix(value, "-")
+		column, ok := constants.PaymentSortFields[name]
+		if !ok || seen[column] {
+			return nil, errPayment.ErrInvalidSort
+		}
+		seen[column] = true
+		fields = append(fields, dto.SortField{Column: column, Desc: desc})
+	}
+
+	return fields, nil
+}
+
+// validateFilters splits comma-separated statuses and rejects unknown
+// statuses and empty ranges.
+func (p *PaymentService) validateFilters(param *dto.PaymentRequestParam) error {
+	statuses := make([]constants.PaymentStatusString, 0, len(param.Statuses))
+	for _, value := range param.Statuses {
+		for _, status := range strings.Split(value.String(), ",") {
+			status := constants.PaymentStatusString(strings.TrimSpace(status))
+			if !status.IsValid() {
+				return errPayment.ErrInvalidStatus
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	param.Statuses = statuses
+
+	if param.MinAmount != nil && param.MaxAmount != nil && *param.MinAmount > *param.MaxAmount {
+		return errPayment.ErrInvalidFilter
+	}
+	for _, dates := range [][2]*time.Time{
+		{param.CreatedFrom, param.CreatedTo},
+		{param.PaidFrom, param.PaidTo},
+		{param.ExpiredFrom, param.ExpiredTo},
+	} {
+		if dates[0] != nil && dates[1] != nil && dates[0].After(*dates[1]) {
+			return errPayment.ErrInvalidFilter
+		}
+	}
+
+	return nil
+}
+
+// validatePaymentRequest checks what the gateway needs to create a
+// transaction: a supported currency, defaulting to rupiah, and customer and
+// item details that add up to the amount.
+func (p *PaymentService) validatePaymentRequest(request *dto.PaymentRequest) error {
+	if request.Currency == "" {
+		request.Currency = constants.IDR
+	}
+	if !money.IsSupported(request.Currency) {
+		return errPayment.ErrUnsupportedCurrency
+	}
+	if request.Amount <= 0 {
+		return errPayment.ErrInvalidAmount
+	}
+
+	if request.CustomerDetail == nil {
+		return fmt.Errorf("customer detail is required")
+	}
+
+	if len(request.ItemDetail) == 0 {
+		return fmt.Errorf("item detail is required")
+	}
+
+	if p.itemsTotal(request.ItemDetail) != request.Amount {
+		return errPayment.ErrItemAmountMismatch
+	}
+
+	return nil
+}
+
+// amountMismatch describes how the amount a gateway reports as paid differs
+// from the amount of the payment, or returns "" when they match.
+func (p *PaymentService) amountMismatch(req *dto.PaymentNotification, payment *models.Payment) string {
+	grossAmount, err := money.Parse(req.GrossAmount, req.Currency)
+	if err != nil {
+		return fmt.Sprintf("gross amount %q %s cannot be verified: %v", req.GrossAmount, req.Currency, err)
+	}
+
+	if grossAmount != payment.Money {
+		return fmt.Sprintf("gross amount %s does not match the payment amount %s", grossAmount, payment.Money)
+	}
+
+	return ""
+}
+
+// recordGatewayRefund records a partial refund made at the gateway of a
+// payment held for review, without moving the payment out of review.
+func (p *PaymentService) recordGatewayRefund(ctx context.Context, tx *gorm.DB, req *dto.PaymentNotification, payment *models.Payment) error {
+	note := "partially refunded at the gateway, still held for review"
+	if req.Refund != nil {
+		refundAmount := money.New(req.Refund.Amount, payment.Currency)
+		note = fmt.Sprintf("%s refunded at the gateway, still held for review", util.RupiahFormat(&refundAmount))
+
+		reason := req.Refund.Reason
+		if reason == "" {
+			reason = "refunded at the gateway"
+		}
+		_, err := p.repository.GetRefund().Create(ctx, tx, &dto.RefundRequest{
+			UUID:      uuid.New(),
+			PaymentID: payment.ID,
+			RefundKey: req.Refund.RefundKey,
+			Money:     refundAmount,
+			Reason:    reason,
+			Status:    constants.RefundSucceeded,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	logrus.Errorf("payment held for review: order %s %s", req.OrderID.String(), note)
+
+	return p.repository.GetPaymentHistory().Create(ctx, tx, &dto.PaymentHistoryRequest{
+		PaymentID: payment.ID,
+		Status:    constants.PartialRefundString,
+		Note:      &note,
+	})
+}
+
+// itemsTotal sums price × quantity of the items, the way Midtrans checks
+// them against the gross amount.
+func (p *PaymentService) itemsTotal(items []dto.ItemDetail) int64 {
+	var total int64
+	for _, item := range items {
+		total += item.Amount * int64(item.Quantity)
+	}
+	return total
+}
+
+// WebHook verifies and processes a notification sent by the gateway of the
+// provider.
+func (p *PaymentService) WebHook(ctx context.Context, provider constants.PaymentProvider, payload []byte) error {
+	paymentGateway, err := p.gateway.Get(provider)
+	if err != nil {
+		return err
+	}
+
+	req, err := paymentGateway.ParseNotification(payload)
+	if err != nil {
+		logrus.Warnf("rejected %s webhook: %v", paymentGateway.Provider(), err)
+		return err
+	}
+
+	return p.applyNotification(ctx, req)
+}
+
+// notificationKey identifies a notification. Besides the transaction status,
+// it holds the fraud status, so that notifications differing only in it are
+// never mistaken for one another, and the refund, since gateways notify every
+// refund of a transaction with the same transaction ID.
+func (p *PaymentService) notificationKey(req *dto.PaymentNotification) string {
+	key := fmt.Sprintf("%s|%s|%s|%s|%s", req.Provider, req.OrderID, req.TransactionID, req.TransactionStatus, req.FraudStatus)
+	if req.Refund != nil {
+		key = fmt.Sprintf("%s|%s|%d", key, req.Refund.RefundKey, req.Refund.Amount)
+	}
+
+	return util.GenerateSHA256(key)
+}
+
+// applyNotification stores a verified notification and processes it, unless
+// the same notification was already processed. Gateways retry notifications
+// until they get a 2xx, so the same notification may arrive several times.
+func (p *PaymentService) applyNotification(ctx context.Context, req *dto.PaymentNotification) error {
+	event, created, err := p.repository.GetWebhookEvent().Create(ctx, p.repository.GetTx(), &dto.WebhookEventRequest{
+		Provider:          req.Provider,
+		OrderID:           req.OrderID,
+		TransactionID:     req.TransactionID,
+		TransactionStatus: req.TransactionStatus,
+		NotificationKey:   p.notificationKey(req),
+		Payload:           req.RawPayload,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !created && event.Status == constants.WebhookEventProcessed {
+		logrus.Infof("duplicate webhook for order %s with status %s, already processed", req.OrderID.String(), req.TransactionStatus)
+		return nil
+	}
+
+	err = p.processWebHook(ctx, req, event.ID, false)
+	if err != nil {
+		p.markWebhookEventFailed(ctx, event.ID, err)
+		return err
+	}
+
+	return nil
+}
+
+// ReplayWebHook re-feeds a stored notification through the webhook
+// processing, whether or not it was processed before. The status transition
+// rules make replaying an already applied notification a no-op.
+func (p *PaymentService) ReplayWebHook(ctx context.Context, uuid string) (*dto.WebhookEventResponse, error) {
+	event, err := p.repository.GetWebhookEvent().FindByUUID(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.replayWebhookEvent(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err = p.repository.GetWebhookEvent().FindByUUID(ctx, uuid)
+	if err != nil {
+		return nil, err
 	}
-	return paymentStatus
+
+	return p.toWebhookEventResponse(event), nil
 }
 
-func (p *PaymentService) produceToKafka(req *dto.WebHook, payment *models.Payment, paidAt *time.Time) error {
-	event := dto.KafkaEvent{
-		Name: p.mapTransactionStatusToEvent(req.TransactionStatus),
+func (p *PaymentService) ReplayWebHooks(ctx context.Context, param *dto.WebhookEventRequestParam) ([]dto.WebhookEventResponse, error) {
+	events, err := p.repository.GetWebhookEvent().FindAll(ctx, param)
+	if err != nil {
+		return nil, err
 	}
 
-	metadata := dto.KafkaMetaData{
-		Sender:    "payment-service",
-		SendingAt: time.Now().Format(time.RFC3339),
+	results := make([]dto.WebhookEventResponse, 0, len(events))
+	for _, event := range events {
+		err = p.replayWebhookEvent(ctx, &event)
+		if err != nil {
+			logrus.Errorf("failed to replay webhook event %s: %v", event.UUID, err)
+		}
+
+		replayed, findErr := p.repository.GetWebhookEvent().FindByUUID(ctx, event.UUID.String())
+		if findErr != nil {
+			return nil, findErr
+		}
+		results = append(results, *p.toWebhookEventResponse(replayed))
 	}
 
-	body := dto.KafkaBody{
-		Type: "JSON",
-		Data: &dto.KafkaData{
-			OrderID:   payment.OrderID,
-			PaymentID: payment.UUID,
-			Status:    req.TransactionStatus.String(),
-			PaidAt:    paidAt,
-			ExpiredAt: *payment.ExpiredAt,
-		},
+	return results, nil
+}
+
+func (p *PaymentService) replayWebhookEvent(ctx context.Context, event *models.WebhookEvent) error {
+	paymentGateway, err := p.gateway.Get(event.Provider)
+	if err != nil {
+		return err
 	}
 
-	kafkaMessage := dto.KafkaMessage{
-		Event:    event,
-		MetaData: metadata,
-		Body:     body,
+	req, err := paymentGateway.ParseNotification([]byte(event.Payload))
+	if err != nil {
+		p.markWebhookEventFailed(ctx, event.ID, err)
+		return err
 	}
 
-	topic := config.Config.Kafka.Topic
-	kafkaMessageJSON, _ := json.Marshal(kafkaMessage)
-	err := p.kafka.GetKafkaProducer().ProduceMessage(topic, kafkaMessageJSON)
+	logrus.Infof("replaying webhook event %s for order %s with status %s", event.UUID, event.OrderID, event.TransactionStatus)
+	err = p.processWebHook(ctx, req, event.ID, true)
 	if err != nil {
+		p.markWebhookEventFailed(ctx, event.ID, err)
 		return err
 	}
+
 	return nil
 }
 
-func (p *PaymentService) WebHook(ctx context.Context, req *dto.WebHook) error {
+func (p *PaymentService) markWebhookEventFailed(ctx context.Context, eventID uint, cause error) {
+	errMessage := cause.Error()
+	err := p.repository.GetWebhookEvent().Update(ctx, p.repository.GetTx(), eventID, &dto.UpdateWebhookEventRequest{
+		Status: constants.WebhookEventFailed,
+		Error:  &errMessage,
+	})
+	if err != nil {
+		logrus.Errorf("failed to mark webhook event %d as failed: %v", eventID, err)
+	}
+}
+
+func (p *PaymentService) toWebhookEventResponse(event *models.WebhookEvent) *dto.WebhookEventResponse {
+	return &dto.WebhookEventResponse{
+		UUID:              event.UUID,
+		Provider:          event.Provider,
+		OrderID:           event.OrderID,
+		TransactionID:     event.TransactionID,
+		TransactionStatus: event.TransactionStatus,
+		Status:            event.Status,
+		Error:             event.Error,
+		ProcessedAt:       event.ProcessedAt,
+		CreatedAt:         event.CreatedAt,
+	}
+}
+
+func (p *PaymentService) processWebHook(ctx context.Context, req *dto.PaymentNotification, eventID uint, replay bool) error {
 	var (
 		// txErr, err         error
 		paymentAfterUpdate *models.Payment
 		paidAt             *time.Time
 		invoiceLink        string
 		pdf                []byte
+		transactionStatus  = req.TransactionStatus
+		paid               = req.Paid
 	)
 
-	// Debug logging untuk webhook request
-	fmt.Printf("=== WEBHOOK DEBUG START ===\n")
-	fmt.Printf("Request OrderID: %v\n", req.OrderID)
-	fmt.Printf("Request OrderID String: %s\n", req.OrderID.String())
-	fmt.Printf("Request TransactionID: %s\n", req.TransactionID)
-	fmt.Printf("Request TransactionStatus: %v\n", req.TransactionStatus)
-	fmt.Printf("Request TransactionStatus String: %s\n", req.TransactionStatus.String())
-	fmt.Printf("Request PaymentType: %s\n", req.PaymentType)
-	fmt.Printf("Request VANumbers: %+v\n", req.VANumbers)
-	if len(req.VANumbers) > 0 {
-		fmt.Printf("VANumbers[0] VaNumber: %s\n", req.VANumbers[0].VaNumber)
-		fmt.Printf("VANumbers[0] Bank: %s\n", req.VANumbers[0].Bank)
-	}
-	fmt.Printf("Request Acquirer: %v\n", req.Acquirer)
-	if req.Acquirer != nil {
-		fmt.Printf("Request Acquirer Value: %s\n", *req.Acquirer)
-	}
-	fmt.Printf("===============================\n")
-
 	err := p.repository.GetTx().Transaction(func(tx *gorm.DB) error {
-		fmt.Printf("=== TRANSACTION START ===\n")
+		// Lock the stored notification so concurrent deliveries of the same
+		// notification are processed only once.
+		event, txErr := p.repository.GetWebhookEvent().FindByIDForUpdate(ctx, tx, eventID)
+		if txErr != nil {
+			return txErr
+		}
+
+		if event.Status == constants.WebhookEventProcessed && !replay {
+			return nil
+		}
+
+		markProcessed := func() error {
+			return p.repository.GetWebhookEvent().Update(ctx, tx, eventID, &dto.UpdateWebhookEventRequest{
+				Status: constants.WebhookEventProcessed,
+			})
+		}
 
 		// Find payment by OrderID
-		fmt.Printf("Finding payment by OrderID: %s\n", req.OrderID.String())
-		payment, txErr := p.repository.GetPayment().FindByOrderID(ctx, req.OrderID.String())
+		payment, txErr := p.repository.GetPayment().FindByOrderIDForUpdate(ctx, tx, req.OrderID.String())
 		if txErr != nil {
-			fmt.Printf("ERROR: Failed to find payment by OrderID: %v\n", txErr)
-			fmt.Printf("ERROR Type: %T\n", txErr)
-			fmt.Printf("ERROR String: %s\n", txErr.Error())
 			return txErr
 		}
-		fmt.Printf("Payment found successfully: UUID=%s, Status=%v\n", payment.UUID, payment.Status)
 
-		// Set paidAt if settlement
-		if req.TransactionStatus == constants.SettlementString {
+		if payment.Provider != req.Provider {
+			logrus.Warnf("rejected %s webhook for order %s paid with %s", req.Provider, req.OrderID.String(), payment.Provider)
+			return errPayment.ErrProviderMismatch
+		}
+
+		// Refunds made through the refund API are recorded before the
+		// gateway is called. Their notification completes them, in case the
+		// refund API failed after the gateway refunded.
+		if req.Refund != nil {
+			refund, txErr := p.repository.GetRefund().FindByRefundKeyForUpdate(ctx, tx, req.Refund.RefundKey)
+			if txErr == nil {
+				if refund.Status != constants.RefundSucceeded {
+					txErr = p.completeRefund(ctx, tx, payment, refund)
+					if txErr != nil {
+						return txErr
+					}
+				}
+				logrus.Infof("refund %s of order %s already recorded", req.Refund.RefundKey, req.OrderID.String())
+				return markProcessed()
+			}
+			if !errors.Is(txErr, errPayment.ErrRefundNotFound) {
+				return txErr
+			}
+		}
+
+		// A payment is only settled for the amount it was created with; any
+		// other amount is held for review instead.
+		var historyNote *string
+		if paid {
+			mismatch := p.amountMismatch(req, payment)
+			if mismatch != "" {
+				logrus.Errorf("payment amount mismatch: order %s paid at %s held for review: %s",
+					req.OrderID.String(), payment.Provider, mismatch)
+				transactionStatus = constants.NeedsReviewString
+				paid = false
+				historyNote = &mismatch
+			}
+		}
+
+		// A payment held for review is only refunded in full through the
+		// refund API. A partial refund made at the gateway directly keeps it
+		// held for review, since the rest of what was paid still has to be
+		// resolved; the refund is recorded so that it counts against what is
+		// left to refund.
+		currentStatus := *payment.Status
+		nextStatus := transactionStatus.GetStatusInt()
+		if currentStatus == constants.NeedsReview && nextStatus == constants.PartialRefund {
+			txErr = p.recordGatewayRefund(ctx, tx, req, payment)
+			if txErr != nil {
+				return txErr
+			}
+			return markProcessed()
+		}
+
+		// Ignore notifications that would move the payment backwards, e.g. a
+		// late pending or expire arriving after settlement.
+		if !currentStatus.CanTransitionTo(nextStatus) {
+			note := fmt.Sprintf("ignored notification: transition from %s to %s is not allowed",
+				currentStatus.GetStatusString(), transactionStatus)
+			logrus.Warnf("webhook for order %s %s", req.OrderID.String(), note)
+			txErr = p.repository.GetPaymentHistory().Create(ctx, tx, &dto.PaymentHistoryRequest{
+				PaymentID: payment.ID,
+				Status:    transactionStatus,
+				Note:      &note,
+			})
+			if txErr != nil {
+				return txErr
+			}
+
+			return markProcessed()
+		}
+
+		// Set paidAt the first time the payment is paid; a card capture
+		// followed by its settlement must not be invoiced twice.
+		paid = paid && payment.PaidAt == nil
+		if paid {
 			now := time.Now()
 			paidAt = &now
-			fmt.Printf("Transaction is settlement, setting paidAt: %v\n", *paidAt)
 		}
 
 		// Prepare update data
-		status := req.TransactionStatus.GetStatusInt()
-		fmt.Printf("Status conversion: %v -> %v\n", req.TransactionStatus, status)
+		status := nextStatus
 
-		var vaNumber, bank string
-		if len(req.VANumbers) > 0 {
-			vaNumber = req.VANumbers[0].VaNumber
-			bank = req.VANumbers[0].Bank
-			fmt.Printf("VA Details - Number: %s, Bank: %s\n", vaNumber, bank)
-		} else {
-			fmt.Printf("WARNING: No VANumbers provided in request\n")
-		}
+		vaNumber := req.VANumber
+		bank := req.Bank
 
 		// Update payment - UBAH: Handle update request berdasarkan payment method
-		fmt.Printf("Updating payment with OrderID: %s\n", req.OrderID.String())
 		updateRequest := &dto.UpdatePaymentRequest{
 			TransactionID: &req.TransactionID,
 			Status:        &status,
@@ -422,47 +890,51 @@ func (p *PaymentService) WebHook(ctx context.Context, req *dto.WebHook) error {
 		if bank != "" {
 			updateRequest.Bank = &bank
 		}
+		if req.PaymentMethod != "" {
+			updateRequest.PaymentMethod = &req.PaymentMethod
+		}
 
-		fmt.Printf("Update request: %+v\n", updateRequest)
-
-		updatedPayment, txErr := p.repository.GetPayment().Update(ctx, tx, req.OrderID.String(), updateRequest)
+		_, txErr = p.repository.GetPayment().Update(ctx, tx, req.OrderID.String(), updateRequest)
 		if txErr != nil {
-			fmt.Printf("ERROR: Failed to update payment: %v\n", txErr)
-			fmt.Printf("ERROR Type: %T\n", txErr)
-			fmt.Printf("ERROR String: %s\n", txErr.Error())
 			return txErr
 		}
-		fmt.Printf("Payment updated successfully: %+v\n", updatedPayment)
 
 		// Get updated payment
-		fmt.Printf("Fetching updated payment by OrderID: %s\n", req.OrderID.String())
-		paymentAfterUpdate, txErr = p.repository.GetPayment().FindByOrderID(ctx, req.OrderID.String())
+		paymentAfterUpdate, txErr = p.repository.GetPayment().FindByOrderIDForUpdate(ctx, tx, req.OrderID.String())
 		if txErr != nil {
-			fmt.Printf("ERROR: Failed to fetch updated payment: %v\n", txErr)
 			return txErr
 		}
-		fmt.Printf("Updated payment fetched: UUID=%s, Status=%v, Bank=%v, VANumber=%v\n",
-			paymentAfterUpdate.UUID, paymentAfterUpdate.Status, paymentAfterUpdate.Bank, paymentAfterUpdate.VANumber)
 
 		// Create payment history
-		fmt.Printf("Creating payment history for PaymentID: %d\n", paymentAfterUpdate.ID)
 		txErr = p.repository.GetPaymentHistory().Create(ctx, tx, &dto.PaymentHistoryRequest{
 			PaymentID: paymentAfterUpdate.ID,
 			Status:    paymentAfterUpdate.Status.GetStatusString(),
+			Note:      historyNote,
 		})
 		if txErr != nil {
-			fmt.Printf("ERROR: Failed to create payment history: %v\n", txErr)
 			return txErr
 		}
-		fmt.Printf("Payment history created successfully\n")
 
-		// Generate invoice if settlement
-		if req.TransactionStatus == constants.SettlementString {
-			fmt.Printf("=== INVOICE GENERATION START ===\n")
+		// Record refunds made outside the refund API, e.g. on the gateway
+		// dashboard, so that they count towards the refunded total.
+		if req.Refund != nil {
+			_, txErr = p.repository.GetRefund().Create(ctx, tx, &dto.RefundRequest{
+				UUID:      uuid.New(),
+				PaymentID: paymentAfterUpdate.ID,
+				RefundKey: req.Refund.RefundKey,
+				Money:     money.New(req.Refund.Amount, paymentAfterUpdate.Currency),
+				Reason:    req.Refund.Reason,
+				Status:    constants.RefundSucceeded,
+			})
+			if txErr != nil {
+				return txErr
+			}
+		}
 
+		// Generate invoice once the payment is paid
+		if paid {
 			if paidAt == nil {
-				fmt.Printf("ERROR: paidAt is nil for settlement transaction\n")
-				return fmt.Errorf("paidAt is nil for settlement transaction")
+				return fmt.Errorf("paidAt is nil for paid transaction")
 			}
 
 			paidDay := paidAt.Format("02")
@@ -470,18 +942,14 @@ func (p *PaymentService) WebHook(ctx context.Context, req *dto.WebHook) error {
 			paidYear := paidAt.Format("2006")
 			invoiceNumber := fmt.Sprintf("INV/%s/ORD/%d", time.Now().Format(time.DateOnly), p.randomNumber())
 
-			fmt.Printf("Invoice details - Day: %s, Month: %s, Year: %s, Number: %s\n",
-				paidDay, paidMonth, paidYear, invoiceNumber)
-
 			// UBAH: Handle different payment methods untuk invoice
 			var paymentMethodDisplay, bankDisplay, vaDisplay string
 
-			switch req.PaymentType {
+			switch req.PaymentMethod {
 			case "qris":
 				paymentMethodDisplay = "QRIS"
 				bankDisplay = "Digital Payment"
 				vaDisplay = "-"
-				fmt.Printf("QRIS payment detected, using default values\n")
 			case "bank_transfer":
 				paymentMethodDisplay = "Bank Transfer"
 				if paymentAfterUpdate.Bank != nil {
@@ -494,27 +962,22 @@ func (p *PaymentService) WebHook(ctx context.Context, req *dto.WebHook) error {
 				} else {
 					vaDisplay = "-"
 				}
-				fmt.Printf("Bank transfer detected, Bank: %s, VA: %s\n", bankDisplay, vaDisplay)
 			case "credit_card":
 				paymentMethodDisplay = "Credit Card"
 				bankDisplay = "Credit Card Payment"
 				vaDisplay = "-"
-				fmt.Printf("Credit card payment detected\n")
 			default:
-				paymentMethodDisplay = strings.ToUpper(req.PaymentType)
+				paymentMethodDisplay = strings.ToUpper(req.PaymentMethod)
 				bankDisplay = "Electronic Payment"
 				vaDisplay = "-"
-				fmt.Printf("Other payment method detected: %s\n", req.PaymentType)
 			}
 
 			// UBAH: Hanya cek Description (yang memang harus ada)
 			if paymentAfterUpdate.Description == nil {
-				fmt.Printf("ERROR: Description is nil in payment after update\n")
 				return fmt.Errorf("description is nil in payment")
 			}
 
-			total := util.RupiahFormat(&paymentAfterUpdate.Amount)
-			fmt.Printf("Formatted total: %s\n", total)
+			total := util.RupiahFormat(&paymentAfterUpdate.Money)
 
 			invoiceRequest := &dto.InvoiceRequest{
 				InvoiceNumber: invoiceNumber,
@@ -536,61 +999,42 @@ func (p *PaymentService) WebHook(ctx context.Context, req *dto.WebHook) error {
 				},
 			}
 
-			fmt.Printf("Invoice request prepared: %+v\n", invoiceRequest)
-
 			// Generate PDF
-			fmt.Printf("Generating PDF for invoice...\n")
 			pdf, txErr = p.GeneratePDF(invoiceRequest)
 			if txErr != nil {
-				fmt.Printf("ERROR: Failed to generate PDF: %v\n", txErr)
 				return txErr
 			}
-			fmt.Printf("PDF generated successfully, size: %d bytes\n", len(pdf))
 
 			// Upload to GCS
-			fmt.Printf("Uploading PDF to GCS with invoice number: %s\n", invoiceNumber)
 			invoiceLink, txErr = p.UploadToGCS(ctx, invoiceNumber, pdf)
 			if txErr != nil {
-				fmt.Printf("ERROR: Failed to upload to GCS: %v\n", txErr)
 				return txErr
 			}
-			fmt.Printf("PDF uploaded successfully, link: %s\n", invoiceLink)
 
 			// Update payment with invoice link
-			fmt.Printf("Updating payment with invoice link...\n")
 			_, txErr = p.repository.GetPayment().Update(ctx, tx, req.OrderID.String(), &dto.UpdatePaymentRequest{
 				InvoiceLink: &invoiceLink,
 			})
 			if txErr != nil {
-				fmt.Printf("ERROR: Failed to update payment with invoice link: %v\n", txErr)
 				return txErr
 			}
-			fmt.Printf("Payment updated with invoice link successfully\n")
-			fmt.Printf("=== INVOICE GENERATION END ===\n")
+			paymentAfterUpdate.InvoiceLink = &invoiceLink
 		}
 
-		fmt.Printf("=== TRANSACTION END ===\n")
-		return nil
-	})
-
-	if err != nil {
-		fmt.Printf("ERROR: Transaction failed: %v\n", err)
-		return err
-	}
+		// Write the Kafka event to the outbox in the same transaction so it
+		// is published if and only if the payment update is committed.
+		logrus.Debugf("writing %s event to the outbox", transactionStatus)
+		txErr = p.produceToOutbox(ctx, tx, transactionStatus, paymentAfterUpdate)
+		if txErr != nil {
+			return txErr
+		}
 
-	// Produce to Kafka
-	fmt.Printf("=== KAFKA PRODUCTION START ===\n")
-	fmt.Printf("Producing to Kafka with payment: %+v\n", paymentAfterUpdate)
-	fmt.Printf("PaidAt: %v\n", paidAt)
+		return markProcessed()
+	})
 
-	err = p.produceToKafka(req, paymentAfterUpdate, paidAt)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to produce to Kafka: %v\n", err)
 		return err
 	}
-	fmt.Printf("Kafka message produced successfully\n")
-	fmt.Printf("=== KAFKA PRODUCTION END ===\n")
 
-	fmt.Printf("=== WEBHOOK DEBUG END ===\n")
 	return nil
 }
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	midtransClient "payment-service/clients/midtrans"
+	"payment-service/common/money"
+	"payment-service/common/util"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseSort(t *testing.T) {
+	value := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		param   dto.PaymentRequestParam
+		want    []dto.SortField
+		wantErr bool
+	}{
+		{name: "no sort", param: dto.PaymentRequestParam{}},
+		{name: "blank sort", param: dto.PaymentRequestParam{Sort: value(" ")}},
+		{
+			name:  "single field",
+			param: dto.PaymentRequestParam{Sort: value("amount")},
+			want:  []dto.SortField{{Column: "amount"}},
+		},
+		{
+			name:  "several fields with desc prefix",
+			param: dto.PaymentRequestParam{Sort: value("-paid_at, created_at")},
+			want:  []dto.SortField{{Column: "paid_at", Desc: true}, {Column: "created_at"}},
+		},
+		{
+			name:  "legacy column and order",
+			param: dto.PaymentRequestParam{SortColumn: value("created_at"), SortOrder: value("DESC")},
+			want:  []dto.SortField{{Column: "created_at", Desc: true}},
+		},
+		{
+			name:  "legacy column without order",
+			param: dto.PaymentRequestParam{SortColumn: value("status")},
+			want:  []dto.SortField{{Column: "status"}},
+		},
+		{
+			name:  "sort takes precedence over legacy parameters",
+			param: dto.PaymentRequestParam{Sort: value("amount"), SortColumn: value("status"), SortOrder: value("desc")},
+			want:  []dto.SortField{{Column: "amount"}},
+		},
+		{name: "unknown field", param: dto.PaymentRequestParam{Sort: value("customer_id")}, wantErr: true},
+		{name: "injected expression", param: dto.PaymentRequestParam{Sort: value("amount; DROP TABLE payments")}, wantErr: true},
+		{name: "legacy unknown column", param: dto.PaymentRequestParam{SortColumn: value("id desc")}, wantErr: true},
+		{name: "repeated field", param: dto.PaymentRequestParam{Sort: value("amount,-amount")}, wantErr: true},
+		{name: "double desc prefix", param: dto.PaymentRequestParam{Sort: value("--amount")}, wantErr: true},
+		{name: "empty field", param: dto.PaymentRequestParam{Sort: value("amount,")}, wantErr: true},
+	}
+
+	service := &PaymentService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.parseSort(&tt.param)
+			if tt.wantErr {
+				if !errors.Is(err, errPayment.ErrInvalidSort) {
+					t.Fatalf("parseSort() error = %v, want %v", err, errPayment.ErrInvalidSort)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSort() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseSort() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// midtransNotification returns a signed Midtrans notification of the
+// payment.
+func midtransNotification(t *testing.T, serverKey string, payment models.Payment, status constants.PaymentStatusString, fraud constants.FraudStatus) []byte {
+	t.Helper()
+
+	grossAmount := payment.Money.Decimal() + ".00"
+	notification := midtransClient.Notification{
+		TransactionTime:   time.Now().Format(time.DateTime),
+		TransactionStatus: status,
+		TransactionID:     "txn-" + payment.OrderID.String(),
+		StatusCode:        "200",
+		PaymentType:       "credit_card",
+		OrderID:           payment.OrderID,
+		GrossAmount:       grossAmount,
+		FraudStatus:       fraud,
+		Currency:          constants.IDR,
+		SignatureKey:      util.GenerateSHA512(payment.OrderID.String() + "200" + grossAmount + serverKey),
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	return payload
+}
+
+func TestWebHookChallengedCaptureIsPaidOnceAccepted(t *testing.T) {
+	const serverKey = "server-key"
+	env := newTestEnv(t, fakeGatewayRegistry{
+		constants.MidtransProvider: midtransClient.NewMidtransClient(serverKey, false),
+	})
+	payment := env.addPayment(constants.Pending, 150000, constants.MidtransProvider)
+	ctx := context.Background()
+
+	err := env.service.WebHook(ctx, constants.MidtransProvider,
+		midtransNotification(t, serverKey, payment, constants.CaptureString, constants.FraudChallenge))
+	if err != nil {
+		t.Fatalf("WebHook(challenge) error = %v", err)
+	}
+
+	challenged := env.payment(t, payment.OrderID)
+	if *challenged.Status != constants.Authorize || challenged.PaidAt != nil || challenged.InvoiceLink != nil {
+		t.Fatalf("challenged payment = %s, paid at %v, invoice %v, want an unpaid authorize",
+			challenged.Status.GetStatusString(), challenged.PaidAt, challenged.InvoiceLink)
+	}
+
+	err = env.service.WebHook(ctx, constants.MidtransProvider,
+		midtransNotification(t, serverKey, payment, constants.CaptureString, constants.FraudAccept))
+	if err != nil {
+		t.Fatalf("WebHook(accept) error = %v", err)
+	}
+
+	accepted := env.payment(t, payment.OrderID)
+	if *accepted.Status != constants.Capture || accepted.PaidAt == nil || accepted.InvoiceLink == nil {
+		t.Fatalf("accepted payment = %s, paid at %v, invoice %v, want a paid capture with an invoice",
+			accepted.Status.GetStatusString(), accepted.PaidAt, accepted.InvoiceLink)
+	}
+
+	events := make([]string, 0)
+	for _, message := range env.outbox() {
+		events = append(events, message.Headers[constants.KafkaHeaderEventName])
+	}
+	if !slices.Equal(events, []string{"AUTHORIZE", "CAPTURE"}) {
+		t.Errorf("outbox events = %v, want [AUTHORIZE CAPTURE]", events)
+	}
+
+	// The settlement that follows moves the payment on without invoicing it
+	// again.
+	err = env.service.WebHook(ctx, constants.MidtransProvider,
+		midtransNotification(t, serverKey, payment, constants.SettlementString, constants.FraudAccept))
+	if err != nil {
+		t.Fatalf("WebHook(settlement) error = %v", err)
+	}
+	settled := env.payment(t, payment.OrderID)
+	if *settled.Status != constants.Settlement || !settled.PaidAt.Equal(*accepted.PaidAt) || len(env.gcs.uploads) != 1 {
+		t.Errorf("settled payment = %s, paid at %v, %d invoices, want settlement paid at %v with one invoice",
+			settled.Status.GetStatusString(), settled.PaidAt, len(env.gcs.uploads), accepted.PaidAt)
+	}
+}
+
+func TestWebHookDeniedChallenge(t *testing.T) {
+	const serverKey = "server-key"
+	env := newTestEnv(t, fakeGatewayRegistry{
+		constants.MidtransProvider: midtransClient.NewMidtransClient(serverKey, false),
+	})
+	payment := env.addPayment(constants.Pending, 150000, constants.MidtransProvider)
+	ctx := context.Background()
+
+	for _, fraud := range []constants.FraudStatus{constants.FraudChallenge, constants.FraudDeny} {
+		err := env.service.WebHook(ctx, constants.MidtransProvider,
+			midtransNotification(t, serverKey, payment, constants.CaptureString, fraud))
+		if err != nil {
+			t.Fatalf("WebHook(%s) error = %v", fraud, err)
+		}
+	}
+
+	denied := env.payment(t, payment.OrderID)
+	if *denied.Status != constants.Deny || denied.PaidAt != nil {
+		t.Errorf("denied payment = %s, paid at %v, want an unpaid deny", denied.Status.GetStatusString(), denied.PaidAt)
+	}
+}
+
+func TestWebHookAmountMismatchIsHeldForReview(t *testing.T) {
+	const serverKey = "server-key"
+	env := newTestEnv(t, fakeGatewayRegistry{
+		constants.MidtransProvider: midtransClient.NewMidtransClient(serverKey, false),
+	})
+	payment := env.addPayment(constants.Pending, 150000, constants.MidtransProvider)
+	ctx := context.Background()
+
+	underpaid := payment
+	underpaid.Money = money.New(100000, constants.IDR)
+	err := env.service.WebHook(ctx, constants.MidtransProvider,
+		midtransNotification(t, serverKey, underpaid, constants.SettlementString, constants.FraudAccept))
+	if err != nil {
+		t.Fatalf("WebHook(settlement) error = %v", err)
+	}
+
+	held := env.payment(t, payment.OrderID)
+	if *held.Status != constants.NeedsReview || held.PaidAt != nil || held.InvoiceLink != nil {
+		t.Fatalf("underpaid payment = %s, paid at %v, invoice %v, want it held for review unpaid",
+			held.Status.GetStatusString(), held.PaidAt, held.InvoiceLink)
+	}
+
+	// A partial refund made at the gateway keeps it held for review, and
+	// counts against what is left to refund.
+	refunded := midtransRefund(t, midtransNotification(t, serverKey, underpaid, constants.PartialRefundString, constants.FraudAccept),
+		midtransClient.Refund{RefundKey: "dashboard", RefundAmount: "40000.00", Reason: "goodwill"})
+	err = env.service.WebHook(ctx, constants.MidtransProvider, refunded)
+	if err != nil {
+		t.Fatalf("WebHook(partial_refund) error = %v", err)
+	}
+
+	if got := env.payment(t, payment.OrderID); *got.Status != constants.NeedsReview {
+		t.Errorf("partially refunded payment = %s, want needs_review", got.Status.GetStatusString())
+	}
+	total, err := env.service.repository.GetRefund().SumAmountByPaymentID(ctx, nil, payment.ID, constants.RefundSucceeded)
+	if err != nil || total != 40000 {
+		t.Errorf("refunded = %d, %v, want the gateway refund recorded", total, err)
+	}
+
+	// Its notification again records nothing twice.
+	err = env.service.WebHook(ctx, constants.MidtransProvider, refunded)
+	if err != nil {
+		t.Fatalf("WebHook(partial_refund) again error = %v", err)
+	}
+	total, _ = env.service.repository.GetRefund().SumAmountByPaymentID(ctx, nil, payment.ID, constants.RefundSucceeded)
+	if total != 40000 {
+		t.Errorf("refunded = %d, want 40000", total)
+	}
+
+	// Refunding the rest at the gateway resolves it.
+	err = env.service.WebHook(ctx, constants.MidtransProvider,
+		midtransNotification(t, serverKey, underpaid, constants.RefundString, constants.FraudAccept))
+	if err != nil {
+		t.Fatalf("WebHook(refund) error = %v", err)
+	}
+	if got := env.payment(t, payment.OrderID); *got.Status != constants.Refund {
+		t.Errorf("refunded payment = %s, want refund", got.Status.GetStatusString())
+	}
+
+	events := make([]string, 0)
+	for _, message := range env.outbox() {
+		events = append(events, message.Headers[constants.KafkaHeaderEventName])
+	}
+	if !slices.Equal(events, []string{"NEEDS_REVIEW", "REFUND"}) {
+		t.Errorf("outbox events = %v, want [NEEDS_REVIEW REFUND]", events)
+	}
+}
+
+// midtransRefund adds refunds to a Midtrans notification; they are not part
+// of its signature.
+func midtransRefund(t *testing.T, payload []byte, refunds ...midtransClient.Refund) []byte {
+	t.Helper()
+
+	var notification midtransClient.Notification
+	err := json.Unmarshal(payload, &notification)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	notification.Refunds = refunds
+
+	payload, err = json.Marshal(notification)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	return payload
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"payment-service/config"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultReconcileLookback = 7 * 24 * time.Hour
+	defaultReconcileMinAge   = 15 * time.Minute
+	defaultReconcileBatch    = 100
+)
+
+func (p *PaymentService) reconcileInterval() time.Duration {
+	return time.Duration(config.Config.Reconcile.IntervalInMinutes) * time.Minute
+}
+
+func (p *PaymentService) reconcileLookback() time.Duration {
+	if config.Config.Reconcile.LookbackInHours > 0 {
+		return time.Duration(config.Config.Reconcile.LookbackInHours) * time.Hour
+	}
+	return defaultReconcileLookback
+}
+
+// reconcileMinAge keeps payments that changed recently out of a run, so that
+// the reconciler does not race the webhook that is about to arrive.
+func (p *PaymentService) reconcileMinAge() time.Duration {
+	if config.Config.Reconcile.MinAgeInMinutes > 0 {
+		return time.Duration(config.Config.Reconcile.MinAgeInMinutes) * time.Minute
+	}
+	return defaultReconcileMinAge
+}
+
+func (p *PaymentService) reconcileBatchSize() int {
+	if config.Config.Reconcile.BatchSize > 0 {
+		return config.Config.Reconcile.BatchSize
+	}
+	return defaultReconcileBatch
+}
+
+// Reconcile compares the active payments with the status their gateway
+// reports and applies the differences through the webhook processing, as if
+// the missed notification had arrived.
+func (p *PaymentService) Reconcile(ctx context.Context) (*dto.ReconcileReport, error) {
+	now := time.Now()
+	param := &dto.ReconcileRequestParam{
+		Statuses:      constants.ActiveStatuses(),
+		CreatedAfter:  now.Add(-p.reconcileLookback()),
+		UpdatedBefore: now.Add(-p.reconcileMinAge()),
+		Limit:         p.reconcileBatchSize(),
+	}
+	report := &dto.ReconcileReport{
+		Mismatches: []dto.ReconcileMismatch{},
+	}
+
+	for {
+		payments, err := p.repository.GetPayment().FindForReconcile(ctx, param)
+		if err != nil {
+			return report, err
+		}
+
+		for _, payment := range payments {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			p.reconcilePayment(ctx, &payment, report)
+		}
+
+		if len(payments) < param.Limit {
+			return report, nil
+		}
+		param.AfterID = payments[len(payments)-1].ID
+	}
+}
+
+func (p *PaymentService) reconcilePayment(ctx context.Context, payment *models.Payment, report *dto.ReconcileReport) {
+	report.Checked++
+	mismatch := dto.ReconcileMismatch{
+		PaymentID:   payment.UUID,
+		OrderID:     payment.OrderID,
+		Provider:    payment.Provider,
+		LocalStatus: payment.Status.GetStatusString(),
+	}
+	fail := func(err error) {
+		logrus.Errorf("failed to reconcile payment for order %s: %v", payment.OrderID.String(), err)
+		mismatch.Result = constants.ReconcileFailed
+		mismatch.Error = err.Error()
+		report.Failed++
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+
+	paymentGateway, err := p.gateway.Get(payment.Provider)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	// A payment link the customer never opened has no transaction at the
+	// gateway yet.
+	notification, err := paymentGateway.GetStatus(payment.OrderID.String())
+	if err != nil {
+		if errors.Is(err, errPayment.ErrGatewayTransactionNotFound) {
+			report.NotFound++
+			return
+		}
+		fail(err)
+		return
+	}
+
+	mismatch.GatewayStatus = notification.TransactionStatus
+	status := notification.TransactionStatus.GetStatusInt()
+	if status == *payment.Status {
+		report.InSync++
+		return
+	}
+
+	if !payment.Status.CanTransitionTo(status) {
+		logrus.Warnf("payment for order %s is %s locally but %s at %s, not reconciled",
+			payment.OrderID.String(), mismatch.LocalStatus, mismatch.GatewayStatus, payment.Provider)
+		mismatch.Result = constants.ReconcileConflict
+		report.Conflicts++
+		report.Mismatches = append(report.Mismatches, mismatch)
+		return
+	}
+
+	err = p.applyNotification(ctx, notification)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	logrus.Infof("reconciled payment for order %s from %s to %s",
+		payment.OrderID.String(), mismatch.LocalStatus, mismatch.GatewayStatus)
+	mismatch.Result = constants.ReconcileFixed
+	report.Fixed++
+	report.Mismatches = append(report.Mismatches, mismatch)
+}
+
+// RunReconciler reconciles the active payments every configured interval
+// until ctx is cancelled.
+func (p *PaymentService) RunReconciler(ctx context.Context) {
+	logrus.Infof("payment reconciler started, running every %s", p.reconcileInterval())
+	ticker := time.NewTicker(p.reconcileInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logrus.Infof("payment reconciler stopped")
+			return
+		case <-ticker.C:
+		}
+
+		report, err := p.Reconcile(ctx)
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorf("payment reconciliation failed: %v", err)
+		}
+		logrus.Infof("reconciled %d payments: %d in sync, %d fixed, %d not found, %d conflicts, %d failed",
+			report.Checked, report.InSync, report.Fixed, report.NotFound, report.Conflicts, report.Failed)
+	}
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"payment-service/common/money"
+	"payment-service/common/util"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Refund refunds a paid payment at its gateway, fully or partially, and
+// records the refund with its credit note. The refunds of a payment never
+// add up to more than its amount.
+//
+// The refund is stored as pending and committed before the gateway is
+// called, and only finalized afterwards, so that a failure after the money
+// has left never loses the refund. With an idempotency key, the refund key is
+// derived from it: a retry resumes the pending refund with the same refund
+// key, which the gateway refunds only once, or returns the finished refund.
+func (p *PaymentService) Refund(ctx context.Context, paymentUUID string, request *dto.CreateRefundRequest) (*dto.RefundResponse, error) {
+	payment, err := p.repository.GetPayment().FindByUUID(ctx, paymentUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	orderID := payment.OrderID.String()
+	refundKey := uuid.New()
+	if request.IdempotencyKey != "" {
+		refundKey = uuid.NewSHA1(payment.UUID, []byte(request.IdempotencyKey))
+	}
+
+	// A payment held for review was paid, but not its amount. Only what the
+	// customer actually paid can be refunded.
+	var paidAmount *int64
+	if *payment.Status == constants.NeedsReview {
+		amount, err := p.paidAmount(payment)
+		if err != nil {
+			return nil, err
+		}
+		paidAmount = &amount
+	}
+
+	refund, err := p.reserveRefund(ctx, orderID, refundKey, request, paidAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	switch refund.Status {
+	case constants.RefundFailed:
+		return nil, errPayment.ErrRefundDeclined
+	case constants.RefundPending:
+		paymentGateway, err := p.gateway.Get(payment.Provider)
+		if err != nil {
+			return nil, err
+		}
+
+		err = paymentGateway.Refund(orderID, &dto.GatewayRefundRequest{
+			RefundKey: refund.RefundKey,
+			Amount:    refund.Amount,
+			Reason:    refund.Reason,
+		})
+		if errors.Is(err, errPayment.ErrGatewayRejected) {
+			logrus.Warnf("refund %s of order %s declined by the gateway: %v", refund.RefundKey, orderID, err)
+			failed := constants.RefundFailed
+			err = p.repository.GetRefund().Update(ctx, p.repository.GetTx(), refund.ID, &dto.UpdateRefundRequest{
+				Status: &failed,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return nil, errPayment.ErrRefundDeclined
+		}
+		if err != nil {
+			// Whether the gateway refunded is unknown; the refund stays
+			// pending so that a retry with the same key resumes it.
+			logrus.Errorf("refund %s of order %s left pending: %v", refund.RefundKey, orderID, err)
+			return nil, err
+		}
+
+		err = p.repository.GetTx().Transaction(func(tx *gorm.DB) error {
+			payment, txErr := p.repository.GetPayment().FindByOrderIDForUpdate(ctx, tx, orderID)
+			if txErr != nil {
+				return txErr
+			}
+
+			refund, txErr = p.repository.GetRefund().FindByRefundKeyForUpdate(ctx, tx, refund.RefundKey)
+			if txErr != nil {
+				return txErr
+			}
+
+			// The webhook of the refund may have completed it already.
+			if refund.Status == constants.RefundSucceeded {
+				return nil
+			}
+
+			return p.completeRefund(ctx, tx, payment, refund)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	payment, err = p.repository.GetPayment().FindByUUID(ctx, paymentUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The credit note is generated after the refund is committed, so that a
+	// failing render or upload never undoes a refund; a retry generates it.
+	if refund.CreditNoteLink == nil {
+		refundAmount := money.New(refund.Amount, refund.Currency)
+		creditNoteLink, err := p.generateCreditNote(ctx, payment, refundAmount, refund.Reason)
+		if err == nil {
+			err = p.repository.GetRefund().Update(ctx, p.repository.GetTx(), refund.ID, &dto.UpdateRefundRequest{
+				CreditNoteLink: &creditNoteLink,
+			})
+		}
+		if err != nil {
+			logrus.Errorf("failed to generate the credit note of refund %s: %v", refund.UUID, err)
+		} else {
+			refund.CreditNoteLink = &creditNoteLink
+		}
+	}
+
+	refunded, err := p.repository.GetRefund().SumAmountByPaymentID(ctx, p.repository.GetTx(), payment.ID, constants.RefundSucceeded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.RefundResponse{
+		UUID:           refund.UUID,
+		PaymentID:      payment.UUID,
+		OrderID:        payment.OrderID,
+		Money:          refund.Money,
+		RefundedAmount: refunded,
+		Reason:         refund.Reason,
+		Status:         refund.Status,
+		PaymentStatus:  payment.Status.GetStatusString(),
+		CreditNoteLink: refund.CreditNoteLink,
+		CreatedAt:      refund.CreatedAt,
+	}, nil
+}
+
+// paidAmount returns the amount the gateway received for the payment.
+func (p *PaymentService) paidAmount(payment *models.Payment) (int64, error) {
+	paymentGateway, err := p.gateway.Get(payment.Provider)
+	if err != nil {
+		return 0, err
+	}
+
+	status, err := paymentGateway.GetStatus(payment.OrderID.String())
+	if err != nil {
+		return 0, err
+	}
+
+	paid, err := money.Parse(status.GrossAmount, status.Currency)
+	if err != nil {
+		return 0, err
+	}
+
+	return paid.Amount, nil
+}
+
+// reserveRefund stores a pending refund of the payment of the order, or
+// returns the refund already stored with the same refund key. A payment held
+// for review is refunded in full, for paidAmount, the amount the customer
+// actually paid.
+func (p *PaymentService) reserveRefund(ctx context.Context, orderID string, refundKey uuid.UUID, request *dto.CreateRefundRequest, paidAmount *int64) (*models.Refund, error) {
+	var refund *models.Refund
+	err := p.repository.GetTx().Transaction(func(tx *gorm.DB) error {
+		payment, txErr := p.repository.GetPayment().FindByOrderIDForUpdate(ctx, tx, orderID)
+		if txErr != nil {
+			return txErr
+		}
+
+		refund, txErr = p.repository.GetRefund().FindByRefundKeyForUpdate(ctx, tx, refundKey.String())
+		if txErr == nil {
+			if refund.PaymentID != payment.ID || refund.Reason != request.Reason ||
+				(request.Amount != nil && *request.Amount != refund.Amount) {
+				return errPayment.ErrIdempotencyKeyMismatch
+			}
+			return nil
+		}
+		if !errors.Is(txErr, errPayment.ErrRefundNotFound) {
+			return txErr
+		}
+
+		// A payment held for review is not marked as paid, but it was.
+		currentStatus := *payment.Status
+		total := payment.Amount
+		switch {
+		case currentStatus == constants.NeedsReview:
+			if paidAmount == nil {
+				return errPayment.ErrRefundNotAllowed
+			}
+			total = *paidAmount
+		case payment.PaidAt == nil || !currentStatus.CanTransitionTo(constants.Refund):
+			return errPayment.ErrRefundNotAllowed
+		}
+
+		// Pending refunds count as refunded, since they may have succeeded.
+		refunded, txErr := p.repository.GetRefund().SumAmountByPaymentID(ctx, tx, payment.ID,
+			constants.RefundPending, constants.RefundSucceeded)
+		if txErr != nil {
+			return txErr
+		}
+
+		remaining := total - refunded
+		amount := remaining
+		if request.Amount != nil {
+			amount = *request.Amount
+		}
+		if amount <= 0 || amount > remaining {
+			return errPayment.ErrRefundExceedsPaid
+		}
+		if currentStatus == constants.NeedsReview && amount != remaining {
+			return errPayment.ErrRefundMustBeFull
+		}
+
+		refund, txErr = p.repository.GetRefund().Create(ctx, tx, &dto.RefundRequest{
+			UUID:      uuid.New(),
+			PaymentID: payment.ID,
+			RefundKey: refundKey.String(),
+			Money:     money.New(amount, payment.Currency),
+			Reason:    request.Reason,
+			Status:    constants.RefundPending,
+		})
+		return txErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// completeRefund marks a refund the gateway made as succeeded and moves the
+// locked payment to refund or partial_refund, depending on how much of it has
+// been refunded.
+func (p *PaymentService) completeRefund(ctx context.Context, tx *gorm.DB, payment *models.Payment, refund *models.Refund) error {
+	succeeded := constants.RefundSucceeded
+	err := p.repository.GetRefund().Update(ctx, tx, refund.ID, &dto.UpdateRefundRequest{
+		Status: &succeeded,
+	})
+	if err != nil {
+		return err
+	}
+	refund.Status = succeeded
+
+	refunded, err := p.repository.GetRefund().SumAmountByPaymentID(ctx, tx, payment.ID, constants.RefundSucceeded)
+	if err != nil {
+		return err
+	}
+
+	// A payment held for review is only refunded in full through this API,
+	// for what is left of the amount paid after refunds made at the gateway.
+	currentStatus := *payment.Status
+	status := constants.PartialRefund
+	if refunded >= payment.Amount || currentStatus == constants.NeedsReview {
+		status = constants.Refund
+	}
+
+	if !currentStatus.CanTransitionTo(status) {
+		logrus.Warnf("refund %s of order %s recorded without moving the payment from %s to %s",
+			refund.RefundKey, payment.OrderID.String(), currentStatus.GetStatusString(), status.GetStatusString())
+		return nil
+	}
+
+	_, err = p.repository.GetPayment().Update(ctx, tx, payment.OrderID.String(), &dto.UpdatePaymentRequest{
+		Status: &status,
+	})
+	if err != nil {
+		return err
+	}
+
+	refundAmount := money.New(refund.Amount, refund.Currency)
+	note := fmt.Sprintf("refunded %s: %s", util.RupiahFormat(&refundAmount), refund.Reason)
+	err = p.repository.GetPaymentHistory().Create(ctx, tx, &dto.PaymentHistoryRequest{
+		PaymentID: payment.ID,
+		Status:    status.GetStatusString(),
+		Note:      &note,
+	})
+	if err != nil {
+		return err
+	}
+
+	payment.Status = &status
+	return p.produceToOutbox(ctx, tx, status.GetStatusString(), payment)
+}
+
+// generateCreditNote renders the credit note of a refund with the invoice
+// template and uploads it, returning its link.
+func (p *PaymentService) generateCreditNote(ctx context.Context, payment *models.Payment, amount money.Money, reason string) (string, error) {
+	now := time.Now()
+	creditNoteNumber := fmt.Sprintf("CN/%s/ORD/%d", now.Format(time.DateOnly), p.randomNumber())
+
+	paymentMethod, bank, vaNumber := "-", "-", "-"
+	if payment.PaymentMethod != nil {
+		paymentMethod = strings.ToUpper(*payment.PaymentMethod)
+	}
+	if payment.Bank != nil {
+		bank = strings.ToUpper(*payment.Bank)
+	}
+	if payment.VANumber != nil {
+		vaNumber = *payment.VANumber
+	}
+
+	description := reason
+	if payment.Description != nil {
+		description = fmt.Sprintf("%s (%s)", *payment.Description, reason)
+	}
+
+	total := util.RupiahFormat(&amount)
+	pdf, err := p.GeneratePDF(&dto.InvoiceRequest{
+		InvoiceNumber: creditNoteNumber,
+		Data: dto.InvoiceData{
+			PaymentDetail: dto.InvoicePaymentDetail{
+				PaymentMethod: paymentMethod,
+				BankName:      bank,
+				VANumber:      vaNumber,
+				Date:          fmt.Sprintf("%s %s %s", now.Format("02"), p.ConvertToIndonesianMonth(now.Format("January")), now.Format("2006")),
+				IsPaid:        true,
+			},
+			Items: []dto.InvoiceItem{
+				{
+					Description: description,
+					Price:       total,
+				},
+			},
+			Total:        total,
+			IsCreditNote: true,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return p.UploadToGCS(ctx, creditNoteNumber, pdf)
+}
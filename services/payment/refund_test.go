@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"payment-service/constants"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+	"payment-service/domain/models"
+	"testing"
+)
+
+// settle adds a payment settled at the gateway.
+func (e *testEnv) settle(t *testing.T, paymentGateway *fakeGateway, amount int64) models.Payment {
+	t.Helper()
+
+	payment := e.addPayment(constants.Settlement, amount, constants.FakeProvider)
+	_, err := paymentGateway.SimulateNotification(&dto.SimulateNotificationRequest{
+		OrderID:           payment.OrderID,
+		Amount:            amount,
+		TransactionStatus: constants.SettlementString,
+	})
+	if err != nil {
+		t.Fatalf("SimulateNotification() error = %v", err)
+	}
+	return payment
+}
+
+func refundRequest(amount int64, idempotencyKey string) *dto.CreateRefundRequest {
+	request := &dto.CreateRefundRequest{Reason: "out of stock", IdempotencyKey: idempotencyKey}
+	if amount > 0 {
+		request.Amount = &amount
+	}
+	return request
+}
+
+func TestRefund(t *testing.T) {
+	paymentGateway := newFakeGateway()
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: paymentGateway})
+	payment := env.settle(t, paymentGateway, 150000)
+	ctx := context.Background()
+
+	paymentGateway.onRefund = func(string, *dto.GatewayRefundRequest) error {
+		if env.inTransaction() {
+			t.Error("gateway called inside a transaction")
+		}
+		return nil
+	}
+
+	partial, err := env.service.Refund(ctx, payment.UUID.String(), refundRequest(50000, "first"))
+	if err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	if partial.Status != constants.RefundSucceeded || partial.RefundedAmount != 50000 ||
+		partial.PaymentStatus != constants.PartialRefundString || partial.CreditNoteLink == nil {
+		t.Errorf("Refund() = %+v, want a succeeded partial refund with its credit note", partial)
+	}
+
+	// A retry replays the refund without refunding at the gateway again.
+	replayed, err := env.service.Refund(ctx, payment.UUID.String(), refundRequest(50000, "first"))
+	if err != nil || replayed.UUID != partial.UUID || replayed.RefundedAmount != 50000 {
+		t.Fatalf("Refund() retry = %+v, %v, want the refund %s", replayed, err, partial.UUID)
+	}
+	if got := len(paymentGateway.refunds); got != 1 {
+		t.Errorf("gateway refunded %d times, want once", got)
+	}
+
+	_, err = env.service.Refund(ctx, payment.UUID.String(), refundRequest(60000, "first"))
+	if !errors.Is(err, errPayment.ErrIdempotencyKeyMismatch) {
+		t.Errorf("Refund() of another amount with the same key error = %v, want %v", err, errPayment.ErrIdempotencyKeyMismatch)
+	}
+
+	_, err = env.service.Refund(ctx, payment.UUID.String(), refundRequest(100001, "over"))
+	if !errors.Is(err, errPayment.ErrRefundExceedsPaid) {
+		t.Errorf("Refund() of more than remains error = %v, want %v", err, errPayment.ErrRefundExceedsPaid)
+	}
+
+	// Without an amount, the rest is refunded.
+	rest, err := env.service.Refund(ctx, payment.UUID.String(), refundRequest(0, "rest"))
+	if err != nil {
+		t.Fatalf("Refund() of the rest error = %v", err)
+	}
+	if rest.Amount != 100000 || rest.RefundedAmount != 150000 || rest.PaymentStatus != constants.RefundString {
+		t.Errorf("Refund() of the rest = %+v, want 100000 refunded in full", rest)
+	}
+
+	_, err = env.service.Refund(ctx, payment.UUID.String(), refundRequest(0, "again"))
+	if !errors.Is(err, errPayment.ErrRefundNotAllowed) {
+		t.Errorf("Refund() of a refunded payment error = %v, want %v", err, errPayment.ErrRefundNotAllowed)
+	}
+	if got := env.histories(payment.ID); len(got) != 2 {
+		t.Errorf("payment has %d histories, want one per refund", len(got))
+	}
+}
+
+func TestRefundResumesAfterGatewayFailure(t *testing.T) {
+	paymentGateway := newFakeGateway()
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: paymentGateway})
+	payment := env.settle(t, paymentGateway, 150000)
+	ctx := context.Background()
+
+	// The gateway refunds, but the response is lost.
+	paymentGateway.onRefund = func(orderID string, request *dto.GatewayRefundRequest) error {
+		err := paymentGateway.FakeClient.Refund(orderID, request)
+		if err != nil {
+			return err
+		}
+		return errors.New("gateway timeout")
+	}
+	_, err := env.service.Refund(ctx, payment.UUID.String(), refundRequest(100000, "key"))
+	if err == nil {
+		t.Fatal("Refund() error = nil, want the gateway failure")
+	}
+
+	// The pending refund counts as refunded until it is resolved.
+	_, err = env.service.Refund(ctx, payment.UUID.String(), refundRequest(100000, "other"))
+	if !errors.Is(err, errPayment.ErrRefundExceedsPaid) {
+		t.Errorf("Refund() next to a pending refund error = %v, want %v", err, errPayment.ErrRefundExceedsPaid)
+	}
+
+	paymentGateway.onRefund = nil
+	resumed, err := env.service.Refund(ctx, payment.UUID.String(), refundRequest(100000, "key"))
+	if err != nil {
+		t.Fatalf("Refund() retry error = %v", err)
+	}
+	if resumed.Status != constants.RefundSucceeded || resumed.RefundedAmount != 100000 {
+		t.Errorf("Refund() retry = %+v, want the pending refund completed", resumed)
+	}
+	if len(paymentGateway.refunds) != 2 || paymentGateway.refunds[0].RefundKey != paymentGateway.refunds[1].RefundKey {
+		t.Errorf("gateway refunds = %v, want the retry to reuse the refund key", paymentGateway.refunds)
+	}
+
+	status, err := paymentGateway.GetStatus(payment.OrderID.String())
+	if err != nil || status.TransactionStatus != constants.PartialRefundString {
+		t.Errorf("gateway status = %v, %v, want the refund made once", status, err)
+	}
+}
+
+func TestRefundDeclined(t *testing.T) {
+	paymentGateway := newFakeGateway()
+	env := newTestEnv(t, fakeGatewayRegistry{constants.FakeProvider: paymentGateway})
+	payment := env.settle(t, paymentGateway, 150000)
+	ctx := context.Background()
+
+	paymentGateway.onRefund = func(string, *dto.GatewayRefundRequest) error {
+		return errPayment.ErrGatewayRejected
+	}
+	_, err := env.service.Refund(ctx, payment.UUID.String(), refundRequest(0, "key"))
+	if !errors.Is(err, errPayment.ErrRefundDeclined) {
+		t.Fatalf("Refund() error = %v, want %v", err, errPayment.ErrRefundDeclined)
+	}
+
+	paymentGateway.onRefund = nil
+	_, err = env.service.Refund(ctx, payment.UUID.String(), refundRequest(0, "key"))
+	if !errors.Is(err, errPayment.ErrRefundDeclined) || len(paymentGateway.refunds) != 1 {
+		t.Errorf("Refund() retry = %v after %d gateway calls, want the decline replayed", err, len(paymentGateway.refunds))
+	}
+
+	// A declined refund does not count as refunded.
+	refund, err := env.service.Refund(ctx, payment.UUID.String(), refundRequest(0, "another"))
+	if err != nil || refund.RefundedAmount != 150000 {
+		t.Errorf("Refund() with a new key = %+v, %v, want the full amount refunded", refund, err)
+	}
+	if got := env.payment(t, payment.OrderID); *got.Status != constants.Refund {
+		t.Errorf("payment = %s, want refund", got.Status.GetStatusString())
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"payment-service/clients/gateway"
+	errPayment "payment-service/constants/error/payment"
+	"payment-service/domain/dto"
+)
+
+// Simulate moves a payment of a gateway that can sign its own notifications,
+// i.e. the fake gateway, to the requested status by feeding a notification
+// through the webhook processing.
+func (p *PaymentService) Simulate(ctx context.Context, uuid string, request *dto.SimulatePaymentRequest) (*dto.PaymentResponse, error) {
+	payment, err := p.repository.GetPayment().FindByUUID(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentGateway, err := p.gateway.Get(payment.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	simulator, ok := paymentGateway.(gateway.ISimulator)
+	if !ok {
+		return nil, errPayment.ErrSimulationNotSupported
+	}
+
+	payload, err := simulator.SimulateNotification(&dto.SimulateNotificationRequest{
+		OrderID:           payment.OrderID,
+		Amount:            payment.Amount,
+		TransactionStatus: request.Status,
+		PaymentType:       request.PaymentType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.WebHook(ctx, payment.Provider, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.GetByUUID(ctx, uuid)
+}
@@ -1,10 +1,12 @@
 package services
 
 import (
-	clients "payment-service/clients/midtrans"
+	"payment-service/clients/gateway"
 	"payment-service/common/gcs"
+	"payment-service/config"
 	"payment-service/controllers/kafka"
 	"payment-service/repositories"
+	outboxService "payment-service/services/outbox"
 	service "payment-service/services/payment"
 )
 
@@ -12,27 +14,34 @@ type Registry struct {
 	repository repositories.IRepositoryRegistry
 	gcs        gcs.IGCSlient
 	kafka      kafka.IKafkaRegistry
-	midtrans   clients.IMidtransClient
+	gateway    gateway.IGatewayRegistry
 }
 
 type IServiceRegistry interface {
 	GetPayment() service.IPaymentService
+	GetOutbox() outboxService.IOutboxService
 }
 
 func NewServiceRegistry(
 	repositories repositories.IRepositoryRegistry,
 	gcs gcs.IGCSlient,
 	kafka kafka.IKafkaRegistry,
-	midtrans clients.IMidtransClient,
+	gateway gateway.IGatewayRegistry,
 ) IServiceRegistry {
 	return &Registry{
 		repository: repositories,
 		gcs:        gcs,
 		kafka:      kafka,
-		midtrans:   midtrans,
+		gateway:    gateway,
 	}
 }
 
 func (r *Registry) GetPayment() service.IPaymentService {
-	return service.NewPaymentService(r.repository, r.gcs, r.kafka, r.midtrans)
+	return service.NewPaymentService(r.repository, r.gcs, r.kafka, r.gateway)
+}
+
+func (r *Registry) GetOutbox() outboxService.IOutboxService {
+	return outboxService.NewOutboxService(r.repository, r.kafka, map[string]outboxService.EventHandler{
+		config.Config.Kafka.OrderTopic: r.GetPayment().HandleOrderEvent,
+	})
 }